@@ -0,0 +1,96 @@
+// Package auth verifies the bearer tokens callers of the API sign in with and
+// carries the verified identity in request contexts
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"../config"
+	"../storage"
+)
+
+// ErrInvalidToken is returned by verifiers when a token is malformed, badly
+// signed or expired
+var ErrInvalidToken = errors.New("invalid token")
+
+// SessionIssuer is the issuer of the session tokens signed with the session
+// secret when callers sign in with a one-time code
+const SessionIssuer = "account-service/session"
+
+// Identity is the verified identity of a caller
+type Identity struct {
+	// UID is the id of the caller at the identity provider
+	UID string
+	// Role is the role of the user the caller is registered as. Tokens grant
+	// no roles, so callers who are not registered hold none
+	Role storage.Role
+	// UserID is the id of the user the caller is registered as, if any
+	UserID string
+}
+
+// Holds reports whether the identity has one of roles
+func (identity Identity) Holds(roles ...storage.Role) bool {
+	for _, role := range roles {
+		if len(identity.Role) > 0 && identity.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier verifies bearer tokens, returning the identity they were issued to
+type Verifier interface {
+	Verify(ctx context.Context, token string) (Identity, error)
+}
+
+// NewVerifier returns a verifier accepting tokens of the provider named in
+// config and session tokens
+func NewVerifier(ctx context.Context, config config.Auth) (Verifier, error) {
+	var provider Verifier
+	switch config.Provider {
+	case "firebase":
+		firebase, err := NewFirebaseVerifier(ctx, config.FirebaseProjectID, config.FirebaseCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		provider = firebase
+	case "local":
+		provider = NewLocalVerifier(config.LocalSecret, config.LocalIssuer)
+	default:
+		return nil, fmt.Errorf("auth: unknown provider %q", config.Provider)
+	}
+	return Verifiers{NewSessionSigner(config), provider}, nil
+}
+
+// NewSessionSigner returns the signer and verifier of session tokens
+func NewSessionSigner(config config.Auth) *LocalVerifier {
+	return NewLocalVerifier(config.SessionSecret, SessionIssuer)
+}
+
+// Verifiers accepts tokens accepted by any of its verifiers, tried in order
+type Verifiers []Verifier
+
+// Verify returns the identity of the first verifier accepting token
+func (verifiers Verifiers) Verify(ctx context.Context, token string) (Identity, error) {
+	for _, verifier := range verifiers {
+		if identity, err := verifier.Verify(ctx, token); err == nil {
+			return identity, nil
+		}
+	}
+	return Identity{}, ErrInvalidToken
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying identity
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity carried by ctx, if any
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+
+	firebase "firebase.google.com/go/v4"
+	firebaseauth "firebase.google.com/go/v4/auth"
+	"google.golang.org/api/option"
+)
+
+// FirebaseVerifier verifies Firebase ID tokens. Tokens may grant a role with
+// the custom claim role, or admin with the custom claim admin: true
+type FirebaseVerifier struct {
+	client *firebaseauth.Client
+}
+
+// NewFirebaseVerifier returns a verifier of ID tokens of the Firebase project.
+// Credentials are read from credentialsFile, or found from the environment
+// when it is empty
+func NewFirebaseVerifier(ctx context.Context, projectID string, credentialsFile string) (*FirebaseVerifier, error) {
+	var opts []option.ClientOption
+	if len(credentialsFile) > 0 {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: projectID}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := app.Auth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &FirebaseVerifier{client: client}, nil
+}
+
+// Verify checks the signature, audience, issuer and expiry of the ID token
+func (verifier *FirebaseVerifier) Verify(ctx context.Context, token string) (Identity, error) {
+	verified, err := verifier.client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+
+	return Identity{UID: verified.UID}, nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalVerifier(t *testing.T) {
+	verifier := NewLocalVerifier("0123456789abcdef0123456789abcdef", "account-service")
+	sign := func(signer *LocalVerifier, identity Identity, ttl time.Duration) string {
+		token, err := signer.Sign(identity, ttl)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return token
+	}
+	valid := sign(verifier, Identity{UID: "uid-1"}, time.Hour)
+	parts := strings.Split(valid, ".")
+	other := strings.Split(sign(verifier, Identity{UID: "uid-2"}, time.Hour), ".")
+
+	// A correctly signed token claiming roles, which only accounts grant
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"uid-1","iss":"account-service","exp":%d,"role":"admin","admin":true}`, time.Now().Add(time.Hour).Unix())))
+	claimingRole := localHeader + "." + claims + "." + verifier.sign(localHeader+"."+claims)
+
+	tests := []struct {
+		name  string
+		token string
+		want  Identity
+	}{
+		{"valid", valid, Identity{UID: "uid-1"}},
+		{"role claims ignored", claimingRole, Identity{UID: "uid-1"}},
+		{"expired", sign(verifier, Identity{UID: "uid-1"}, -time.Second), Identity{}},
+		{"other secret", sign(NewLocalVerifier("fedcba9876543210fedcba9876543210", "account-service"), Identity{UID: "uid-1"}, time.Hour), Identity{}},
+		{"other issuer", sign(NewLocalVerifier("0123456789abcdef0123456789abcdef", "other"), Identity{UID: "uid-1"}, time.Hour), Identity{}},
+		{"tampered claims", parts[0] + "." + other[1] + "." + parts[2], Identity{}},
+		{"unsigned", parts[0] + "." + parts[1] + ".", Identity{}},
+		{"malformed", "not-a-token", Identity{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := verifier.Verify(context.Background(), test.token)
+			if len(test.want.UID) == 0 {
+				if err != ErrInvalidToken {
+					t.Fatalf("got identity %+v and error %v, want ErrInvalidToken", identity, err)
+				}
+				return
+			}
+			if err != nil || identity != test.want {
+				t.Fatalf("got identity %+v and error %v, want %+v", identity, err, test.want)
+			}
+		})
+	}
+}
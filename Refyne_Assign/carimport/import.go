@@ -0,0 +1,134 @@
+// Package carimport loads cars in bulk from CSV or JSON, validating every row
+// before any car is created
+package carimport
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"../storage"
+	"../validation"
+)
+
+// Result reports the outcome of an import. When Errors is not empty no car
+// was created
+type Result struct {
+	DryRun   bool
+	Total    int
+	Imported int
+	Cars     []storage.Car
+	Errors   []RowError
+}
+
+// Importer validates and creates cars
+type Importer struct {
+	cars storage.CarRepository
+}
+
+// NewImporter returns an importer creating cars in given repository
+func NewImporter(cars storage.CarRepository) *Importer {
+	return &Importer{cars: cars}
+}
+
+// Import validates rows, together with the errors found parsing them, and
+// creates the cars in a single transaction if every row is valid. With
+// dryRun the rows are only validated
+func (importer *Importer) Import(rows []Row, parseErrors []RowError, dryRun bool) (*Result, error) {
+	result := &Result{DryRun: dryRun, Total: len(rows) + len(parseErrors)}
+
+	rowErrors, err := importer.validate(rows)
+	if err != nil {
+		return nil, err
+	}
+	result.Errors = append(append(result.Errors, parseErrors...), rowErrors...)
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	cars := make([]storage.Car, len(rows))
+	for i, row := range rows {
+		cars[i] = row.Car
+	}
+
+	if !dryRun {
+		err = importer.cars.CreateCars(cars)
+		var duplicate *storage.DuplicateLicenseError
+		if errors.As(err, &duplicate) {
+			// A car was created with the same licence number after validation
+			for _, row := range rows {
+				if row.Car.CarLicenseNumber == duplicate.CarLicenseNumber {
+					result.Errors = append(result.Errors, RowError{Row: row.Number, Field: "carLicenseNumber", Message: "licence number already registered"})
+				}
+			}
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Imported = len(cars)
+	}
+
+	result.Cars = cars
+	return result, nil
+}
+
+// validate checks required fields, prices and that licence numbers are
+// unique within the import and among existing cars
+func (importer *Importer) validate(rows []Row) ([]RowError, error) {
+	var rowErrors []RowError
+	problem := func(row Row, field string, message string) {
+		rowErrors = append(rowErrors, RowError{Row: row.Number, Field: field, Message: message})
+	}
+
+	first := map[string]int{}
+	var numbers []string
+	for _, row := range rows {
+		car := row.Car
+		if len(car.CarLicenseNumber) == 0 {
+			problem(row, "carLicenseNumber", "is required")
+		} else if !validation.ValidPlate(car.CarLicenseNumber) {
+			problem(row, "carLicenseNumber", "must be a vehicle registration number, such as KA01AB1234")
+		}
+		if len(car.Manufacturer) == 0 {
+			problem(row, "manufacturer", "is required")
+		}
+		if len(car.Model) == 0 {
+			problem(row, "model", "is required")
+		}
+		if car.BasePrice <= 0 {
+			problem(row, "basePrice", "must be positive")
+		}
+		if car.PPH <= 0 {
+			problem(row, "PPH", "must be positive")
+		}
+		if car.Securitydeposit < 0 {
+			problem(row, "securitydeposit", "must not be negative")
+		}
+
+		if len(car.CarLicenseNumber) == 0 {
+			continue
+		}
+		key := strings.ToUpper(car.CarLicenseNumber)
+		if n, ok := first[key]; ok {
+			problem(row, "carLicenseNumber", "duplicates licence number of row "+strconv.Itoa(n))
+			continue
+		}
+		first[key] = row.Number
+		numbers = append(numbers, car.CarLicenseNumber)
+	}
+
+	existing, err := importer.cars.GetCarsByLicense(numbers)
+	if err != nil {
+		return nil, err
+	}
+	for _, car := range existing {
+		if n, ok := first[strings.ToUpper(car.CarLicenseNumber)]; ok {
+			rowErrors = append(rowErrors, RowError{Row: n, Field: "carLicenseNumber", Message: "licence number already registered to car " + car.ID})
+		}
+	}
+	return rowErrors, nil
+}
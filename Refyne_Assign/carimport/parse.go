@@ -0,0 +1,204 @@
+package carimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"../storage"
+)
+
+// Format is the encoding of a car import
+type Format string
+
+const (
+	// FormatCSV is comma separated values with a header row naming the columns
+	FormatCSV Format = "csv"
+	// FormatJSON is an array of car objects
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the format named by name, such as a file extension
+// or a content type
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimPrefix(name, "."))
+	switch {
+	case name == "csv" || strings.HasPrefix(name, "text/csv"):
+		return FormatCSV, nil
+	case name == "json" || strings.HasPrefix(name, "application/json"):
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unsupported import format %q, expected csv or json", name)
+}
+
+// record represents a car as named in imports, matching the car API
+type record struct {
+	CarLicenseNumber string `json:"carLicenseNumber"`
+	Manufacturer     string `json:"manufacturer"`
+	Model            string `json:"model"`
+	BasePrice        int    `json:"basePrice"`
+	PPH              int    `json:"PPH"`
+	Securitydeposit  int    `json:"securitydeposit"`
+}
+
+// columns lists the CSV columns; all but securitydeposit are required
+var columns = []string{"carLicenseNumber", "manufacturer", "model", "basePrice", "PPH", "securitydeposit"}
+
+// Row represents a car read from an import, numbered from 1 in the order read
+type Row struct {
+	Number int
+	Car    storage.Car
+}
+
+// RowError describes a problem with a row of an import. Field is empty when
+// the problem is not with a single field
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if len(e.Field) == 0 {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.Message)
+}
+
+// Parse reads cars from r in given format. Rows that cannot be read are
+// reported as row errors; an error is returned only if the import as a whole
+// is malformed
+func Parse(r io.Reader, format Format) ([]Row, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSON:
+		return parseJSON(r)
+	}
+	return nil, nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+func parseJSON(r io.Reader) ([]Row, []RowError, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("import is not a JSON array: %v", err)
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+	for i, message := range raw {
+		var rec record
+		if err := json.Unmarshal(message, &rec); err != nil {
+			field := ""
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				field = typeErr.Field
+			}
+			rowErrors = append(rowErrors, RowError{Row: i + 1, Field: field, Message: "malformed car: " + err.Error()})
+			continue
+		}
+		rows = append(rows, Row{Number: i + 1, Car: rec.car()})
+	}
+	return rows, rowErrors, nil
+}
+
+func parseCSV(r io.Reader) ([]Row, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("import has no header row")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		column := canonicalColumn(name)
+		if len(column) == 0 {
+			return nil, nil, fmt.Errorf("unknown column %q, expected %s", name, strings.Join(columns, ", "))
+		}
+		index[column] = i
+	}
+	for _, column := range columns[:5] {
+		if _, ok := index[column]; !ok {
+			return nil, nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+	for number := 1; ; number++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, nil, err
+			}
+			rowErrors = append(rowErrors, RowError{Row: number, Message: err.Error()})
+			continue
+		}
+
+		value := func(column string) string {
+			if i, ok := index[column]; ok {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		number := number
+		integer := func(column string) int {
+			text := value(column)
+			if len(text) == 0 {
+				return 0
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				rowErrors = append(rowErrors, RowError{Row: number, Field: column, Message: fmt.Sprintf("%q is not an integer", text)})
+			}
+			return n
+		}
+
+		failed := len(rowErrors)
+		rec := record{
+			CarLicenseNumber: value("carLicenseNumber"),
+			Manufacturer:     value("manufacturer"),
+			Model:            value("model"),
+			BasePrice:        integer("basePrice"),
+			PPH:              integer("PPH"),
+			Securitydeposit:  integer("securitydeposit"),
+		}
+		if len(rowErrors) == failed {
+			rows = append(rows, Row{Number: number, Car: rec.car()})
+		}
+	}
+	return rows, rowErrors, nil
+}
+
+// canonicalColumn returns the column named by name regardless of case, or
+// an empty string if there is none
+func canonicalColumn(name string) string {
+	for _, column := range columns {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return column
+		}
+	}
+	return ""
+}
+
+// car maps record to dao model
+func (rec record) car() storage.Car {
+	var car storage.Car
+	car.CarLicenseNumber = strings.TrimSpace(rec.CarLicenseNumber)
+	car.Manufacturer = strings.TrimSpace(rec.Manufacturer)
+	car.Model = strings.TrimSpace(rec.Model)
+	car.BasePrice = rec.BasePrice
+	car.PPH = rec.PPH
+	car.Securitydeposit = rec.Securitydeposit
+	return car
+}
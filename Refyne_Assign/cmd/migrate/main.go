@@ -0,0 +1,80 @@
+// Command migrate applies, reverts and reports schema migrations of the
+// application database
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"../../config"
+	"../../storage"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run migrates as the flags ask and returns the exit code, so deferred calls
+// run before the process exits
+func run() int {
+	createDatabase := flag.Bool("create-db", false, "create the application database before migrating")
+	to := flag.Int("to", storage.LatestVersion(), "schema version to migrate up or down to")
+	status := flag.Bool("status", false, "list migrations and whether each is applied, without migrating")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 2
+	}
+
+	if *createDatabase {
+		if err := storage.CreateDatabase(cfg.Database); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate: unable to create database:", err)
+			return 1
+		}
+	}
+
+	store, err := storage.NewMySQLStore(cfg.Database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate: unable to connect to database:", err)
+		return 1
+	}
+	defer store.Close()
+
+	if *status {
+		if err := printStatus(store); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := store.MigrateTo(*to); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	return 0
+}
+
+// printStatus writes a table of migrations and when each was applied
+func printStatus(store *storage.MySQLStore) error {
+	states, err := store.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, state := range states {
+		applied := "pending"
+		if state.AppliedAt != nil {
+			applied = state.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, applied)
+	}
+	return w.Flush()
+}
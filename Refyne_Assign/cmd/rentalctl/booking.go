@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"../../pricing"
+	"../../storage"
+)
+
+// booking runs booking subcommands
+func (ctl *rentalctl) booking(args []string) error {
+	command, args := subcommand(args)
+	switch command {
+	case "cancel":
+		return ctl.cancelBooking(args)
+	}
+	return errUsage
+}
+
+// cancelBooking cancels a booking, refunding it according to the configured
+// cancellation policy like the cancel endpoint does
+func (ctl *rentalctl) cancelBooking(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	policy := pricing.CancellationPolicy{
+		FullRefundBefore:     ctl.config.Cancellation.FullRefundBefore,
+		PartialRefundPercent: ctl.config.Cancellation.PartialRefundPercent,
+	}
+
+	booking, err := ctl.store.CancelBooking(args[0], 0, func(booking storage.CarBooking) int {
+		return policy.Refund(booking, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	return ctl.printBookings([]storage.CarBooking{*booking})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"../../storage"
+	"../../validation"
+)
+
+// car runs car subcommands
+func (ctl *rentalctl) car(args []string) error {
+	command, args := subcommand(args)
+	switch command {
+	case "add":
+		return ctl.addCar(args)
+	case "update":
+		return ctl.updateCar(args)
+	case "retire":
+		return ctl.retireCar(args)
+	case "bookings":
+		return ctl.carBookings(args)
+	case "import":
+		return ctl.importCars(args)
+	}
+	return errUsage
+}
+
+// carFlags registers flags for car fields on flags, initialised from car
+func carFlags(flags *flag.FlagSet, car *storage.Car) {
+	flags.StringVar(&car.CarLicenseNumber, "license", car.CarLicenseNumber, "licence plate number")
+	flags.StringVar(&car.Manufacturer, "manufacturer", car.Manufacturer, "manufacturer")
+	flags.StringVar(&car.Model, "model", car.Model, "model")
+	flags.IntVar(&car.BasePrice, "base-price", car.BasePrice, "base fare of a rental")
+	flags.IntVar(&car.PPH, "pph", car.PPH, "price per hour")
+	flags.IntVar(&car.Securitydeposit, "deposit", car.Securitydeposit, "security deposit")
+}
+
+func (ctl *rentalctl) addCar(args []string) error {
+	var car storage.Car
+	flags := flag.NewFlagSet("car add", flag.ContinueOnError)
+	carFlags(flags, &car)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if len(car.CarLicenseNumber) == 0 || len(car.Manufacturer) == 0 || len(car.Model) == 0 || car.BasePrice <= 0 || car.PPH <= 0 {
+		return fmt.Errorf("car add requires -license, -manufacturer, -model and positive -base-price and -pph")
+	}
+	if !validation.ValidPlate(car.CarLicenseNumber) {
+		return fmt.Errorf("-license %q is not a vehicle registration number, such as KA01AB1234", car.CarLicenseNumber)
+	}
+
+	if err := ctl.store.CreateCar(&car); err != nil {
+		return err
+	}
+	return ctl.printCars([]storage.Car{car})
+}
+
+func (ctl *rentalctl) updateCar(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	car, err := ctl.getCar(args[0])
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("car update", flag.ContinueOnError)
+	carFlags(flags, car)
+	flags.BoolVar(&car.Available, "available", car.Available, "whether the car can be booked")
+	if err = flags.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	if err = ctl.store.UpdateCar(car); err != nil {
+		return err
+	}
+	return ctl.printCars([]storage.Car{*car})
+}
+
+func (ctl *rentalctl) retireCar(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	if err := ctl.store.RetireCar(args[0], 0); err != nil {
+		return err
+	}
+
+	car, err := ctl.getCar(args[0])
+	if err != nil {
+		return err
+	}
+	return ctl.printCars([]storage.Car{*car})
+}
+
+func (ctl *rentalctl) carBookings(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	if _, err := ctl.getCar(args[0]); err != nil {
+		return err
+	}
+
+	bookings, err := ctl.store.GetCarBookings(args[0])
+	if err != nil {
+		return err
+	}
+	return ctl.printBookings(bookings)
+}
+
+// getCar fetches the car with given id, failing if there is none
+func (ctl *rentalctl) getCar(id string) (*storage.Car, error) {
+	car, err := ctl.store.GetCar(id)
+	if err != nil {
+		return nil, err
+	}
+	if car == nil {
+		return nil, fmt.Errorf("no car with id %s exists", id)
+	}
+	return car, nil
+}
+
+func (ctl *rentalctl) printCars(cars []storage.Car) error {
+	var rows [][]string
+	for _, car := range cars {
+		rows = append(rows, []string{
+			car.ID,
+			car.CarLicenseNumber,
+			car.Manufacturer,
+			car.Model,
+			strconv.Itoa(car.BasePrice),
+			strconv.Itoa(car.PPH),
+			strconv.Itoa(car.Securitydeposit),
+			strconv.FormatBool(car.Available),
+			strconv.FormatBool(car.Retired),
+		})
+	}
+	return ctl.printer.print(cars, []string{"ID", "LICENSE", "MANUFACTURER", "MODEL", "BASE PRICE", "PPH", "DEPOSIT", "AVAILABLE", "RETIRED"}, rows)
+}
+
+func (ctl *rentalctl) printBookings(bookings []storage.CarBooking) error {
+	var rows [][]string
+	for _, booking := range bookings {
+		rows = append(rows, []string{
+			booking.BookingId,
+			booking.UserID,
+			string(booking.Status),
+			booking.StartDateTime.Format(time.RFC3339),
+			booking.EndDateTime.Format(time.RFC3339),
+			strconv.Itoa(booking.Total),
+			strconv.Itoa(booking.RefundAmount),
+		})
+	}
+	return ctl.printer.print(bookings, []string{"ID", "USER", "STATUS", "START", "END", "TOTAL", "REFUND"}, rows)
+}
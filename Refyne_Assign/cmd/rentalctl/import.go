@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"../../carimport"
+)
+
+// importCars creates cars from a CSV or JSON file, only if every row is
+// valid. The format defaults to the extension of the file
+func (ctl *rentalctl) importCars(args []string) error {
+	flags := flag.NewFlagSet("car import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without creating cars")
+	formatName := flags.String("format", "", "csv or json, by default the file extension")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	path := flags.Arg(0)
+	if len(*formatName) == 0 {
+		*formatName = filepath.Ext(path)
+	}
+	format, err := carimport.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, parseErrors, err := carimport.Parse(file, format)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	result, err := carimport.NewImporter(ctl.store).Import(rows, parseErrors, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Errors) > 0 {
+		var rows [][]string
+		for _, rowErr := range result.Errors {
+			rows = append(rows, []string{strconv.Itoa(rowErr.Row), rowErr.Field, rowErr.Message})
+		}
+		if err = ctl.printer.print(result.Errors, []string{"ROW", "FIELD", "ERROR"}, rows); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s: found %d problems in %d rows, no cars were imported", path, len(result.Errors), result.Total)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "%s: all %d rows are valid, no cars were imported (dry run)\n", path, result.Total)
+	}
+	return ctl.printCars(result.Cars)
+}
@@ -0,0 +1,106 @@
+// Command rentalctl administers the car fleet and its bookings.
+//
+// Usage:
+//
+//	rentalctl [flags] car add -license KA01AB1234 -manufacturer Maruti -model Swift -base-price 500 -pph 150 -deposit 2000
+//	rentalctl [flags] car update <id> [-license ...] [-available=false]
+//	rentalctl [flags] car retire <id>
+//	rentalctl [flags] car bookings <id>
+//	rentalctl [flags] car import [-dry-run] [-format csv|json] <file>
+//	rentalctl [flags] booking cancel <id>
+//	rentalctl [flags] user role <id> customer|fleet_manager|support|admin
+//	rentalctl [flags] migrate [-to version]
+//	rentalctl [flags] migrate status
+//	rentalctl [flags] utilisation [-from 2006-01-02T15:04:05Z] [-to 2006-01-02T15:04:05Z]
+//
+// Flags include the configuration flags of the server and -o, which selects
+// table or json output.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"../../config"
+	"../../storage"
+)
+
+// errUsage is returned for malformed command lines
+var errUsage = errors.New("usage: rentalctl [flags] car|booking|user|migrate|utilisation ...")
+
+func main() {
+	output := flag.String("o", "table", "output format, table or json")
+	loader := config.NewLoader(flag.CommandLine, config.CancellationSection)
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rentalctl:", err)
+		os.Exit(2)
+	}
+
+	if *output != "table" && *output != "json" {
+		fmt.Fprintln(os.Stderr, "rentalctl: -o must be table or json")
+		os.Exit(2)
+	}
+
+	store, err := storage.NewMySQLStore(cfg.Database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rentalctl: unable to connect to database:", err)
+		os.Exit(1)
+	}
+
+	ctl := &rentalctl{config: cfg, store: store, printer: newPrinter(*output)}
+	err = ctl.run(flag.Args())
+	store.Close()
+
+	if err == errUsage {
+		fmt.Fprintln(os.Stderr, err)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rentalctl:", err)
+		os.Exit(1)
+	}
+}
+
+// rentalctl runs admin commands against the store
+type rentalctl struct {
+	config  *config.Config
+	store   *storage.MySQLStore
+	printer *printer
+}
+
+// run dispatches the command given by args
+func (ctl *rentalctl) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "car":
+		return ctl.car(args)
+	case "booking":
+		return ctl.booking(args)
+	case "user":
+		return ctl.user(args)
+	case "migrate":
+		return ctl.migrate(args)
+	case "utilisation":
+		return ctl.utilisation(args)
+	}
+	return errUsage
+}
+
+// subcommand splits args into a subcommand and its arguments
+func subcommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(args[0]), args[1:]
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"../../storage"
+)
+
+// migrate applies or reverts schema migrations, or lists them with status
+func (ctl *rentalctl) migrate(args []string) error {
+	if len(args) > 0 && args[0] == "status" {
+		return ctl.migrationStatus()
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	to := flags.Int("to", storage.LatestVersion(), "schema version to migrate up or down to")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if err := ctl.store.MigrateTo(*to); err != nil {
+		return err
+	}
+	return ctl.migrationStatus()
+}
+
+func (ctl *rentalctl) migrationStatus() error {
+	states, err := ctl.store.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, state := range states {
+		applied := "pending"
+		if state.AppliedAt != nil {
+			applied = state.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		rows = append(rows, []string{strconv.Itoa(state.Version), state.Name, applied})
+	}
+	return ctl.printer.print(states, []string{"VERSION", "NAME", "APPLIED"}, rows)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes command results as an aligned table or as JSON
+type printer struct {
+	json bool
+}
+
+func newPrinter(format string) *printer {
+	return &printer{json: format == "json"}
+}
+
+// print writes value as JSON, or headers and rows as a table
+func (p *printer) print(value interface{}, headers []string, rows [][]string) error {
+	if p.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"../../storage"
+)
+
+// user runs user subcommands
+func (ctl *rentalctl) user(args []string) error {
+	command, args := subcommand(args)
+	switch command {
+	case "role":
+		return ctl.setUserRole(args)
+	}
+	return errUsage
+}
+
+// setUserRole assigns a role to a user, such as the first admin, who can then
+// assign roles through the API
+func (ctl *rentalctl) setUserRole(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	role := storage.Role(args[1])
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %s, expected one of %v", args[1], storage.Roles)
+	}
+
+	// The change is recorded in the user's history as made by an operator
+	user, err := ctl.store.SetUserRole(args[0], role, "")
+	if err != nil {
+		return err
+	}
+	return ctl.printer.print(user, []string{"ID", "MOBILE", "ROLE"}, [][]string{{user.ID, user.Mobile, string(user.Role)}})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// utilisationEntry represents utilisation of a car in the reported window
+type utilisationEntry struct {
+	CarID            string  `json:"carId"`
+	CarLicenseNumber string  `json:"carLicenseNumber"`
+	Manufacturer     string  `json:"manufacturer"`
+	Model            string  `json:"model"`
+	Bookings         int     `json:"bookings"`
+	BookedHours      float64 `json:"bookedHours"`
+	Utilisation      float64 `json:"utilisation"`
+}
+
+// utilisation prints the share of a window each car was booked for,
+// defaulting to the last 30 days
+func (ctl *rentalctl) utilisation(args []string) error {
+	now := time.Now().UTC().Truncate(time.Hour)
+	flags := flag.NewFlagSet("utilisation", flag.ContinueOnError)
+	fromFlag := flags.String("from", now.AddDate(0, 0, -30).Format(time.RFC3339), "start of the window, RFC 3339")
+	toFlag := flags.String("to", now.Format(time.RFC3339), "end of the window, RFC 3339")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	from, err := time.Parse(time.RFC3339, *fromFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %v", err)
+	}
+	to, err := time.Parse(time.RFC3339, *toFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %v", err)
+	}
+	if !to.After(from) {
+		return fmt.Errorf("-to must be after -from")
+	}
+
+	utilisation, err := ctl.store.Utilisation(from, to)
+	if err != nil {
+		return err
+	}
+
+	window := to.Sub(from)
+	entries := []utilisationEntry{}
+	var rows [][]string
+	for _, u := range utilisation {
+		entry := utilisationEntry{
+			CarID:            u.Car.ID,
+			CarLicenseNumber: u.Car.CarLicenseNumber,
+			Manufacturer:     u.Car.Manufacturer,
+			Model:            u.Car.Model,
+			Bookings:         u.Bookings,
+			BookedHours:      u.BookedDuration.Hours(),
+			Utilisation:      float64(u.BookedDuration) / float64(window),
+		}
+		entries = append(entries, entry)
+		rows = append(rows, []string{
+			entry.CarID,
+			entry.CarLicenseNumber,
+			entry.Manufacturer,
+			entry.Model,
+			strconv.Itoa(entry.Bookings),
+			strconv.FormatFloat(entry.BookedHours, 'f', 1, 64),
+			strconv.FormatFloat(entry.Utilisation*100, 'f', 1, 64) + "%",
+		})
+	}
+	return ctl.printer.print(entries, []string{"ID", "LICENSE", "MANUFACTURER", "MODEL", "BOOKINGS", "BOOKED HOURS", "UTILISATION"}, rows)
+}
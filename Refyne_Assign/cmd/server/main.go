@@ -0,0 +1,163 @@
+// Command server runs the car rental REST API
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"../../auth"
+	"../../config"
+	"../../events"
+	"../../logger"
+	"../../otp"
+	"../../rest"
+	"../../storage"
+	"../../webhook"
+	"go.uber.org/zap"
+)
+
+func main() {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	cfg, err := config.Load(os.Args[1:], config.ServerSections...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if err = storage.CreateDatabase(cfg.Database); err != nil {
+		slog.Fatalw("Unable to create database "+cfg.Database.Name,
+			"error", err)
+	}
+
+	store, err := storage.NewMySQLStore(cfg.Database)
+	if err != nil {
+		slog.Fatalw("Unable to connect to database "+cfg.Database.Name,
+			"error", err)
+	}
+
+	if err = store.Migrate(); err != nil {
+		store.Close()
+		slog.Fatalw("Unable to migrate database "+cfg.Database.Name,
+			"error", err)
+	}
+
+	verifier, err := auth.NewVerifier(context.Background(), cfg.Auth)
+	if err != nil {
+		store.Close()
+		slog.Fatalw("Unable to set up verifying of bearer tokens",
+			"provider", cfg.Auth.Provider,
+			"error", err)
+	}
+
+	sender, err := otp.NewSender(cfg.OTP)
+	if err != nil {
+		store.Close()
+		slog.Fatalw("Unable to set up sending of one-time codes",
+			"sender", cfg.OTP.Sender,
+			"error", err)
+	}
+	if cfg.OTP.Sender == "file" {
+		slog.Warnw("One-time codes are written to a file rather than sent by SMS; use the file sender in development only",
+			"path", cfg.OTP.SenderFilePath)
+	}
+
+	// Publish domain events from the outbox, fanning them out to partner
+	// webhook subscriptions, until shutdown
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	sink := events.MultiSink{events.NewSink(cfg.Outbox, slog), webhook.NewDispatcher(store)}
+	relay := events.NewRelay(cfg.Outbox, store, sink, slog)
+	go func() {
+		relay.Run(relayCtx)
+		close(relayDone)
+	}()
+
+	// Deliver events to partner webhook subscriptions until shutdown
+	deliverer := webhook.NewDeliverer(cfg.Webhooks, store, slog)
+	deliveryDone := make(chan struct{})
+	go func() {
+		deliverer.Run(relayCtx)
+		close(deliveryDone)
+	}()
+
+	// Log statistics of the connection pool until shutdown
+	statsDone := make(chan struct{})
+	go func() {
+		logPoolStats(relayCtx, store, cfg.Database.StatsInterval, slog)
+		close(statsDone)
+	}()
+
+	e := rest.InitRoutes(cfg, store, verifier, sender)
+	e.HideBanner = true
+
+	port := strconv.Itoa(cfg.Server.Port)
+	go func() {
+		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			slog.Fatalw("Unable to serve on port "+port,
+				"error", err)
+		}
+	}()
+
+	// Wait for a termination signal, then stop accepting connections and
+	// drain in-flight requests before closing the database pool
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+
+	slog.Infow("Shutting down server",
+		"signal", sig.String(),
+		"timeout", cfg.Server.ShutdownTimeout.String())
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelfunc()
+
+	if err = e.Shutdown(ctx); err != nil {
+		slog.Errorw("Unable to drain in-flight requests before deadline",
+			"error", err)
+	}
+
+	stopRelay()
+	<-relayDone
+	<-deliveryDone
+	<-statsDone
+
+	if err = store.Close(); err != nil {
+		slog.Errorw("Unable to close database connection pool",
+			"error", err)
+	}
+}
+
+// logPoolStats logs statistics of the connection pool of store every interval
+// until ctx is done. It returns at once when interval is zero
+func logPoolStats(ctx context.Context, store *storage.MySQLStore, interval time.Duration, slog *zap.SugaredLogger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := store.Stats()
+			slog.Infow("Database connection pool statistics",
+				"openConnections", stats.OpenConnections,
+				"inUse", stats.InUse,
+				"idle", stats.Idle,
+				"waitCount", stats.WaitCount,
+				"waitDuration", stats.WaitDuration.String(),
+				"maxIdleClosed", stats.MaxIdleClosed,
+				"maxLifetimeClosed", stats.MaxLifetimeClosed)
+		}
+	}
+}
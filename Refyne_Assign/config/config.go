@@ -0,0 +1,536 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the configuration of the application
+type Config struct {
+	Server       Server
+	Database     Database
+	Pricing      Pricing
+	Cancellation Cancellation
+	Idempotency  Idempotency
+	Outbox       Outbox
+	Webhooks     Webhooks
+	Auth         Auth
+	OTP          OTP
+}
+
+// Server holds configuration of the HTTP server
+type Server struct {
+	Port            int
+	ShutdownTimeout time.Duration
+}
+
+// Database holds configuration of the MySQL database and its connection pool
+type Database struct {
+	Username              string
+	Password              string
+	Hostname              string
+	Name                  string
+	MaxOpenConnections    int
+	MaxIdleConnections    int
+	ConnectionMaxLifetime time.Duration
+	// StatsInterval is the interval between logs of connection pool
+	// statistics, or zero to not log them
+	StatsInterval time.Duration
+}
+
+// Pricing holds configuration of rental pricing
+type Pricing struct {
+	// BillingGranularity is the unit the rented duration is rounded up to
+	BillingGranularity time.Duration
+	// TaxRate is the tax levied on the fare, in basis points
+	TaxRate int
+}
+
+// Cancellation holds configuration of the booking cancellation policy. It
+// applies to the fare only; the security deposit is always refunded
+type Cancellation struct {
+	// FullRefundBefore is how long before the start of a booking it must be
+	// cancelled to be refunded in full
+	FullRefundBefore time.Duration
+	// PartialRefundPercent is the share of the fare refunded on later cancellations
+	PartialRefundPercent int
+}
+
+// Idempotency holds configuration of idempotency keys
+type Idempotency struct {
+	// TTL is how long the response to a request is replayed for retries
+	// with the same idempotency key
+	TTL time.Duration
+	// Lease is how long a key is held by a request still being handled.
+	// Retries are rejected as in progress until then, and handled again after
+	// it, should the request never complete
+	Lease time.Duration
+}
+
+// Outbox holds configuration of the relay publishing domain events
+type Outbox struct {
+	// Sinks names where events are published: log, file and webhook
+	Sinks []string
+	// FilePath is the file the file sink appends events to
+	FilePath string
+	// WebhookURL is the URL the webhook sink posts events to
+	WebhookURL     string
+	WebhookTimeout time.Duration
+	// PollInterval is how often the outbox is checked for events to publish
+	PollInterval time.Duration
+	// BatchSize is the most events published per poll
+	BatchSize int
+	// ClaimTimeout is how long events fetched by a relay are held from other
+	// relays. Events the relay has not published or failed by then are
+	// published again
+	ClaimTimeout time.Duration
+	// RetryBackoff is the delay before retrying a failed event, doubled on
+	// every further failure up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// Error reports every problem found loading configuration
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// setting describes a configuration value, named by key in configuration
+// files, by env in environment and by flag on the command line
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+// settings lists every configuration value
+var settings = []setting{
+	{"server.port", "PORT", "port", "port to serve HTTP on", intSetter(func(c *Config) *int { return &c.Server.Port })},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "deadline for draining in-flight requests on shutdown", durationSetter(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"database.username", "DB_USERNAME", "db-username", "database username", stringSetter(func(c *Config) *string { return &c.Database.Username })},
+	{"database.password", "DB_PASSWORD", "db-password", "database password", stringSetter(func(c *Config) *string { return &c.Database.Password })},
+	{"database.hostname", "DB_HOSTNAME", "db-hostname", "database host and port", stringSetter(func(c *Config) *string { return &c.Database.Hostname })},
+	{"database.name", "DB_NAME", "db-name", "database name", stringSetter(func(c *Config) *string { return &c.Database.Name })},
+	{"database.max_open_connections", "DB_MAX_OPEN_CONNECTIONS", "db-max-open-connections", "maximum open connections in the pool", intSetter(func(c *Config) *int { return &c.Database.MaxOpenConnections })},
+	{"database.max_idle_connections", "DB_MAX_IDLE_CONNECTIONS", "db-max-idle-connections", "maximum idle connections in the pool", intSetter(func(c *Config) *int { return &c.Database.MaxIdleConnections })},
+	{"database.connection_max_lifetime", "DB_CONNECTION_MAX_LIFETIME", "db-connection-max-lifetime", "maximum lifetime of a pooled connection", durationSetter(func(c *Config) *time.Duration { return &c.Database.ConnectionMaxLifetime })},
+	{"database.stats_interval", "DB_STATS_INTERVAL", "db-stats-interval", "interval between logs of connection pool statistics, 0 to disable", durationSetter(func(c *Config) *time.Duration { return &c.Database.StatsInterval })},
+	{"pricing.billing_granularity", "PRICING_BILLING_GRANULARITY", "pricing-billing-granularity", "unit rented durations are rounded up to", durationSetter(func(c *Config) *time.Duration { return &c.Pricing.BillingGranularity })},
+	{"pricing.tax_rate_bps", "PRICING_TAX_RATE_BPS", "pricing-tax-rate-bps", "tax on fares in basis points", intSetter(func(c *Config) *int { return &c.Pricing.TaxRate })},
+	{"cancellation.full_refund_hours", "CANCELLATION_FULL_REFUND_HOURS", "cancellation-full-refund-hours", "hours before start a booking is refunded in full", hoursSetter(func(c *Config) *time.Duration { return &c.Cancellation.FullRefundBefore })},
+	{"cancellation.partial_refund_percent", "CANCELLATION_PARTIAL_REFUND_PERCENT", "cancellation-partial-refund-percent", "percent of the fare refunded on late cancellations", intSetter(func(c *Config) *int { return &c.Cancellation.PartialRefundPercent })},
+	{"idempotency.ttl", "IDEMPOTENCY_TTL", "idempotency-ttl", "how long responses are replayed for retries with the same idempotency key", durationSetter(func(c *Config) *time.Duration { return &c.Idempotency.TTL })},
+	{"idempotency.lease", "IDEMPOTENCY_LEASE", "idempotency-lease", "how long an idempotency key is held by a request still being handled", durationSetter(func(c *Config) *time.Duration { return &c.Idempotency.Lease })},
+	{"outbox.sinks", "OUTBOX_SINKS", "outbox-sinks", "comma separated sinks events are published to: log, file, webhook", listSetter(func(c *Config) *[]string { return &c.Outbox.Sinks })},
+	{"outbox.file_path", "OUTBOX_FILE_PATH", "outbox-file-path", "file the file sink appends events to", stringSetter(func(c *Config) *string { return &c.Outbox.FilePath })},
+	{"outbox.webhook_url", "OUTBOX_WEBHOOK_URL", "outbox-webhook-url", "URL the webhook sink posts events to", stringSetter(func(c *Config) *string { return &c.Outbox.WebhookURL })},
+	{"outbox.webhook_timeout", "OUTBOX_WEBHOOK_TIMEOUT", "outbox-webhook-timeout", "deadline for posting an event to the webhook", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.WebhookTimeout })},
+	{"outbox.poll_interval", "OUTBOX_POLL_INTERVAL", "outbox-poll-interval", "how often the outbox is checked for events", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.PollInterval })},
+	{"outbox.batch_size", "OUTBOX_BATCH_SIZE", "outbox-batch-size", "most events published per poll", intSetter(func(c *Config) *int { return &c.Outbox.BatchSize })},
+	{"outbox.claim_timeout", "OUTBOX_CLAIM_TIMEOUT", "outbox-claim-timeout", "how long events fetched by a relay are held from other relays", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.ClaimTimeout })},
+	{"outbox.retry_backoff", "OUTBOX_RETRY_BACKOFF", "outbox-retry-backoff", "delay before retrying a failed event, doubled per failure", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.RetryBackoff })},
+	{"outbox.max_retry_backoff", "OUTBOX_MAX_RETRY_BACKOFF", "outbox-max-retry-backoff", "longest delay before retrying a failed event", durationSetter(func(c *Config) *time.Duration { return &c.Outbox.MaxRetryBackoff })},
+	{"webhooks.timeout", "WEBHOOKS_TIMEOUT", "webhooks-timeout", "deadline for a partner webhook to respond to a delivery", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.Timeout })},
+	{"webhooks.poll_interval", "WEBHOOKS_POLL_INTERVAL", "webhooks-poll-interval", "how often pending webhook deliveries are attempted", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.PollInterval })},
+	{"webhooks.batch_size", "WEBHOOKS_BATCH_SIZE", "webhooks-batch-size", "most webhook deliveries attempted per poll", intSetter(func(c *Config) *int { return &c.Webhooks.BatchSize })},
+	{"webhooks.claim_timeout", "WEBHOOKS_CLAIM_TIMEOUT", "webhooks-claim-timeout", "how long webhook deliveries fetched by a deliverer are held from other deliverers", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.ClaimTimeout })},
+	{"webhooks.retry_backoff", "WEBHOOKS_RETRY_BACKOFF", "webhooks-retry-backoff", "delay before retrying a failed webhook delivery, doubled per failure", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.RetryBackoff })},
+	{"webhooks.max_retry_backoff", "WEBHOOKS_MAX_RETRY_BACKOFF", "webhooks-max-retry-backoff", "longest delay before retrying a failed webhook delivery", durationSetter(func(c *Config) *time.Duration { return &c.Webhooks.MaxRetryBackoff })},
+	{"webhooks.max_attempts", "WEBHOOKS_MAX_ATTEMPTS", "webhooks-max-attempts", "attempts at a webhook delivery before giving up", intSetter(func(c *Config) *int { return &c.Webhooks.MaxAttempts })},
+	{"auth.provider", "AUTH_PROVIDER", "auth-provider", "verifier of bearer tokens: firebase or local", stringSetter(func(c *Config) *string { return &c.Auth.Provider })},
+	{"auth.firebase_project_id", "FIREBASE_PROJECT_ID", "firebase-project-id", "Firebase project whose ID tokens are accepted", stringSetter(func(c *Config) *string { return &c.Auth.FirebaseProjectID })},
+	{"auth.firebase_credentials_file", "FIREBASE_CREDENTIALS_FILE", "firebase-credentials-file", "service account file of the Firebase project", stringSetter(func(c *Config) *string { return &c.Auth.FirebaseCredentialsFile })},
+	{"auth.local_secret", "AUTH_LOCAL_SECRET", "auth-local-secret", "HS256 key of tokens verified by the local provider", stringSetter(func(c *Config) *string { return &c.Auth.LocalSecret })},
+	{"auth.local_issuer", "AUTH_LOCAL_ISSUER", "auth-local-issuer", "issuer of tokens verified by the local provider", stringSetter(func(c *Config) *string { return &c.Auth.LocalIssuer })},
+	{"auth.session_secret", "AUTH_SESSION_SECRET", "auth-session-secret", "HS256 key of session tokens issued on signing in with a one-time code", stringSetter(func(c *Config) *string { return &c.Auth.SessionSecret })},
+	{"auth.session_ttl", "AUTH_SESSION_TTL", "auth-session-ttl", "how long session tokens are valid", durationSetter(func(c *Config) *time.Duration { return &c.Auth.SessionTTL })},
+	{"otp.code_length", "OTP_CODE_LENGTH", "otp-code-length", "digits in one-time codes", intSetter(func(c *Config) *int { return &c.OTP.CodeLength })},
+	{"otp.ttl", "OTP_TTL", "otp-ttl", "how long a one-time code may be used for", durationSetter(func(c *Config) *time.Duration { return &c.OTP.TTL })},
+	{"otp.max_attempts", "OTP_MAX_ATTEMPTS", "otp-max-attempts", "codes that may be tried against a one-time code", intSetter(func(c *Config) *int { return &c.OTP.MaxAttempts })},
+	{"otp.request_limit", "OTP_REQUEST_LIMIT", "otp-request-limit", "one-time codes that may be sent to a number per window", intSetter(func(c *Config) *int { return &c.OTP.RequestLimit })},
+	{"otp.request_window", "OTP_REQUEST_WINDOW", "otp-request-window", "window one-time code requests are limited over", durationSetter(func(c *Config) *time.Duration { return &c.OTP.RequestWindow })},
+	{"otp.sender", "OTP_SENDER", "otp-sender", "how one-time codes are sent: http, or file in development", stringSetter(func(c *Config) *string { return &c.OTP.Sender })},
+	{"otp.sender_file_path", "OTP_SENDER_FILE_PATH", "otp-sender-file-path", "file the file sender appends messages to", stringSetter(func(c *Config) *string { return &c.OTP.SenderFilePath })},
+	{"otp.sender_url", "OTP_SENDER_URL", "otp-sender-url", "SMS gateway the http sender posts messages to", stringSetter(func(c *Config) *string { return &c.OTP.SenderURL })},
+	{"otp.sender_token", "OTP_SENDER_TOKEN", "otp-sender-token", "bearer token of the SMS gateway", stringSetter(func(c *Config) *string { return &c.OTP.SenderToken })},
+	{"otp.sender_timeout", "OTP_SENDER_TIMEOUT", "otp-sender-timeout", "deadline for the SMS gateway to accept a message", durationSetter(func(c *Config) *time.Duration { return &c.OTP.SenderTimeout })},
+}
+
+// Webhooks holds configuration of deliveries to partner webhook subscriptions
+type Webhooks struct {
+	// Timeout is the deadline for a subscriber to respond to a delivery
+	Timeout time.Duration
+	// PollInterval is how often pending deliveries are attempted
+	PollInterval time.Duration
+	// BatchSize is the most deliveries attempted per poll
+	BatchSize int
+	// ClaimTimeout is how long deliveries fetched by a deliverer are held from
+	// other deliverers. Deliveries whose attempt is not recorded by then are
+	// attempted again
+	ClaimTimeout time.Duration
+	// RetryBackoff is the delay before retrying a failed delivery, doubled on
+	// every further failure up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// MaxAttempts is how many times a delivery is attempted before it is
+	// given up as failed
+	MaxAttempts int
+}
+
+// Auth holds configuration of verifying the bearer tokens callers sign in with
+type Auth struct {
+	// Provider names the verifier of tokens: firebase or local
+	Provider                string
+	FirebaseProjectID       string
+	FirebaseCredentialsFile string
+	// LocalSecret is the HS256 key of tokens verified by the local provider
+	LocalSecret string
+	LocalIssuer string
+	// SessionSecret is the HS256 key of the session tokens issued on signing
+	// in with a one-time code, which are accepted besides provider tokens
+	SessionSecret string
+	SessionTTL    time.Duration
+}
+
+// OTP holds configuration of signing in with one-time codes sent by SMS
+type OTP struct {
+	CodeLength int
+	// TTL is how long a code may be used for
+	TTL time.Duration
+	// MaxAttempts is how many codes may be tried against a challenge
+	MaxAttempts int
+	// RequestLimit is how many codes may be sent to a number per RequestWindow
+	RequestLimit  int
+	RequestWindow time.Duration
+	// Sender names how codes are sent: http, which posts messages to the SMS
+	// gateway at SenderURL, or file, which appends messages to SenderFilePath
+	// in place of sending them and is meant for development only
+	Sender         string
+	SenderFilePath string
+	// SenderURL is the SMS gateway messages are posted to, authenticated
+	// with SenderToken as a bearer token when set
+	SenderURL     string
+	SenderToken   string
+	SenderTimeout time.Duration
+}
+
+// defaults returns configuration holding default values
+func defaults() Config {
+	return Config{
+		Server: Server{
+			Port:            8080,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Database: Database{
+			MaxOpenConnections:    10,
+			MaxIdleConnections:    10,
+			ConnectionMaxLifetime: 3 * time.Minute,
+			StatsInterval:         time.Minute,
+		},
+		Pricing: Pricing{
+			BillingGranularity: time.Hour,
+			TaxRate:            1800,
+		},
+		Cancellation: Cancellation{
+			FullRefundBefore:     24 * time.Hour,
+			PartialRefundPercent: 50,
+		},
+		Idempotency: Idempotency{
+			TTL:   24 * time.Hour,
+			Lease: time.Minute,
+		},
+		Outbox: Outbox{
+			Sinks:           []string{"log"},
+			WebhookTimeout:  10 * time.Second,
+			PollInterval:    time.Second,
+			BatchSize:       100,
+			ClaimTimeout:    5 * time.Minute,
+			RetryBackoff:    time.Second,
+			MaxRetryBackoff: 5 * time.Minute,
+		},
+		Webhooks: Webhooks{
+			Timeout:         10 * time.Second,
+			PollInterval:    time.Second,
+			BatchSize:       100,
+			ClaimTimeout:    5 * time.Minute,
+			RetryBackoff:    10 * time.Second,
+			MaxRetryBackoff: time.Hour,
+			MaxAttempts:     12,
+		},
+		Auth: Auth{
+			Provider:    "firebase",
+			LocalIssuer: "account-service",
+			SessionTTL:  24 * time.Hour,
+		},
+		OTP: OTP{
+			CodeLength:     6,
+			TTL:            5 * time.Minute,
+			MaxAttempts:    5,
+			RequestLimit:   3,
+			RequestWindow:  15 * time.Minute,
+			Sender:         "file",
+			SenderFilePath: "sms.log",
+			SenderTimeout:  10 * time.Second,
+		},
+	}
+}
+
+// Section names a section of the configuration as in the configuration file
+type Section string
+
+// Sections validated only for the commands that require them. The database
+// section is validated for every command
+const (
+	ServerSection       Section = "server"
+	PricingSection      Section = "pricing"
+	CancellationSection Section = "cancellation"
+	IdempotencySection  Section = "idempotency"
+	OutboxSection       Section = "outbox"
+	WebhooksSection     Section = "webhooks"
+	AuthSection         Section = "auth"
+	OTPSection          Section = "otp"
+)
+
+// ServerSections lists the sections required by the API server
+var ServerSections = []Section{ServerSection, PricingSection, CancellationSection, IdempotencySection, OutboxSection, WebhooksSection, AuthSection, OTPSection}
+
+// Loader loads configuration from defaults, an optional YAML or TOML file,
+// environment and command line flags, each overriding the ones before
+type Loader struct {
+	flags *flag.FlagSet
+	file  *string
+	// values holds the command line value of every setting
+	values map[string]*string
+	// required lists the sections validated besides the database
+	required []Section
+}
+
+// NewLoader returns a loader whose flags are registered on flags, validating
+// the required sections besides the database. Load must be called after
+// flags are parsed
+func NewLoader(flags *flag.FlagSet, required ...Section) *Loader {
+	loader := &Loader{
+		flags:    flags,
+		file:     flags.String("config", os.Getenv("CONFIG_FILE"), "path of a YAML or TOML configuration file"),
+		values:   map[string]*string{},
+		required: required,
+	}
+	for _, s := range settings {
+		loader.values[s.flag] = flags.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	return loader
+}
+
+// Load loads configuration from command line arguments, environment and
+// the configuration file named by flag -config or env CONFIG_FILE, validating
+// the required sections besides the database
+func Load(args []string, required ...Section) (*Config, error) {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	loader := NewLoader(flags, required...)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return loader.Load()
+}
+
+// Load loads and validates configuration, reporting all problems found at once
+func (loader *Loader) Load() (*Config, error) {
+	config := defaults()
+	var problems []string
+
+	if len(*loader.file) > 0 {
+		values, err := readFile(*loader.file)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		for _, s := range settings {
+			if value, ok := values[s.key]; ok {
+				problems = appendProblem(problems, s.set(&config, value), "file key "+s.key)
+				delete(values, s.key)
+			}
+		}
+		var unknown []string
+		for key := range values {
+			unknown = append(unknown, "file key "+key+": unknown setting")
+		}
+		sort.Strings(unknown)
+		problems = append(problems, unknown...)
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && len(value) > 0 {
+			problems = appendProblem(problems, s.set(&config, value), "env "+s.env)
+		}
+	}
+
+	visited := map[string]bool{}
+	loader.flags.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+	for _, s := range settings {
+		if visited[s.flag] {
+			problems = appendProblem(problems, s.set(&config, *loader.values[s.flag]), "flag -"+s.flag)
+		}
+	}
+
+	problems = append(problems, config.validate(loader.required)...)
+	if len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+	return &config, nil
+}
+
+// validate returns every problem with the database settings and the
+// required sections of the configuration
+func (config *Config) validate(required []Section) []string {
+	var problems []string
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	check(len(config.Database.Username) > 0, "database.username is required (env DB_USERNAME)")
+	check(len(config.Database.Password) > 0, "database.password is required (env DB_PASSWORD)")
+	check(len(config.Database.Hostname) > 0, "database.hostname is required (env DB_HOSTNAME)")
+	check(len(config.Database.Name) > 0, "database.name is required (env DB_NAME)")
+	check(config.Database.MaxOpenConnections > 0, "database.max_open_connections must be positive")
+	check(config.Database.MaxIdleConnections >= 0, "database.max_idle_connections must not be negative")
+	check(config.Database.ConnectionMaxLifetime > 0, "database.connection_max_lifetime must be positive")
+	check(config.Database.StatsInterval >= 0, "database.stats_interval must not be negative")
+
+	for _, section := range required {
+		sectionChecks[section](config, check)
+	}
+
+	return problems
+}
+
+// sectionChecks checks the values of each section validated on request
+var sectionChecks = map[Section]func(config *Config, check func(ok bool, problem string)){
+	ServerSection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.Server.Port > 0 && config.Server.Port <= 65535, "server.port must be between 1 and 65535")
+		check(config.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	},
+	PricingSection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.Pricing.BillingGranularity > 0, "pricing.billing_granularity must be positive")
+		check(config.Pricing.TaxRate >= 0, "pricing.tax_rate_bps must not be negative")
+	},
+	CancellationSection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.Cancellation.FullRefundBefore >= 0, "cancellation.full_refund_hours must not be negative")
+		check(config.Cancellation.PartialRefundPercent >= 0 && config.Cancellation.PartialRefundPercent <= 100, "cancellation.partial_refund_percent must be between 0 and 100")
+	},
+	IdempotencySection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+		check(config.Idempotency.Lease > 0 && config.Idempotency.Lease <= config.Idempotency.TTL, "idempotency.lease must be positive and not longer than idempotency.ttl")
+	},
+	OutboxSection: func(config *Config, check func(ok bool, problem string)) {
+		for _, sink := range config.Outbox.Sinks {
+			check(sink == "log" || sink == "file" || sink == "webhook", "outbox.sinks: unknown sink "+sink+", expected log, file or webhook")
+			check(sink != "file" || len(config.Outbox.FilePath) > 0, "outbox.file_path is required for the file sink")
+			check(sink != "webhook" || len(config.Outbox.WebhookURL) > 0, "outbox.webhook_url is required for the webhook sink")
+		}
+		check(config.Outbox.WebhookTimeout > 0, "outbox.webhook_timeout must be positive")
+		check(config.Outbox.PollInterval > 0, "outbox.poll_interval must be positive")
+		check(config.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+		check(config.Outbox.ClaimTimeout > config.Outbox.WebhookTimeout, "outbox.claim_timeout must be longer than outbox.webhook_timeout")
+		check(config.Outbox.RetryBackoff > 0, "outbox.retry_backoff must be positive")
+		check(config.Outbox.MaxRetryBackoff >= config.Outbox.RetryBackoff, "outbox.max_retry_backoff must not be less than outbox.retry_backoff")
+	},
+	WebhooksSection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+		check(config.Webhooks.PollInterval > 0, "webhooks.poll_interval must be positive")
+		check(config.Webhooks.BatchSize > 0, "webhooks.batch_size must be positive")
+		check(config.Webhooks.ClaimTimeout > config.Webhooks.Timeout, "webhooks.claim_timeout must be longer than webhooks.timeout")
+		check(config.Webhooks.RetryBackoff > 0, "webhooks.retry_backoff must be positive")
+		check(config.Webhooks.MaxRetryBackoff >= config.Webhooks.RetryBackoff, "webhooks.max_retry_backoff must not be less than webhooks.retry_backoff")
+		check(config.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	},
+	AuthSection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.Auth.Provider == "firebase" || config.Auth.Provider == "local", "auth.provider must be firebase or local")
+		check(config.Auth.Provider != "local" || len(config.Auth.LocalSecret) >= 32, "auth.local_secret of at least 32 characters is required for the local provider (env AUTH_LOCAL_SECRET)")
+		check(len(config.Auth.SessionSecret) >= 32, "auth.session_secret of at least 32 characters is required (env AUTH_SESSION_SECRET)")
+		check(config.Auth.SessionTTL > 0, "auth.session_ttl must be positive")
+	},
+	OTPSection: func(config *Config, check func(ok bool, problem string)) {
+		check(config.OTP.CodeLength >= 4 && config.OTP.CodeLength <= 10, "otp.code_length must be between 4 and 10")
+		check(config.OTP.TTL > 0, "otp.ttl must be positive")
+		check(config.OTP.MaxAttempts > 0, "otp.max_attempts must be positive")
+		check(config.OTP.RequestLimit > 0, "otp.request_limit must be positive")
+		check(config.OTP.RequestWindow > 0, "otp.request_window must be positive")
+		check(config.OTP.Sender == "http" || config.OTP.Sender == "file", "otp.sender must be http or file")
+		check(config.OTP.Sender != "file" || len(config.OTP.SenderFilePath) > 0, "otp.sender_file_path is required for the file sender")
+		check(config.OTP.Sender != "http" || len(config.OTP.SenderURL) > 0, "otp.sender_url is required for the http sender")
+		check(config.OTP.SenderTimeout > 0, "otp.sender_timeout must be positive")
+	},
+}
+
+// appendProblem appends err, if any, as a problem with the value from source
+func appendProblem(problems []string, err error, source string) []string {
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %v", source, err))
+	}
+	return problems
+}
+
+func stringSetter(field func(c *Config) *string) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func listSetter(field func(c *Config) *[]string) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		*field(config) = items
+		return nil
+	}
+}
+
+func intSetter(field func(c *Config) *int) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field(config) = n
+		return nil
+	}
+}
+
+func durationSetter(field func(c *Config) *time.Duration) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		*field(config) = d
+		return nil
+	}
+}
+
+func hoursSetter(field func(c *Config) *time.Duration) func(*Config, string) error {
+	return func(config *Config, value string) error {
+		hours, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number of hours", value)
+		}
+		*field(config) = time.Duration(hours) * time.Hour
+		return nil
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// readFile reads a YAML or TOML configuration file, chosen by extension,
+// into values keyed by dotted path, e.g. database.username
+func readFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %v", err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+// flatten stores leaf values of a decoded tree in values under dotted keys
+func flatten(prefix string, node interface{}, values map[string]string) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			flatten(join(prefix, key), child, values)
+		}
+	case map[interface{}]interface{}:
+		for key, child := range node {
+			flatten(join(prefix, fmt.Sprint(key)), child, values)
+		}
+	case []interface{}:
+		items := make([]string, len(node))
+		for i, item := range node {
+			items[i] = fmt.Sprint(item)
+		}
+		values[prefix] = strings.Join(items, ",")
+	default:
+		values[prefix] = fmt.Sprint(node)
+	}
+}
+
+func join(prefix string, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return prefix + "." + key
+}
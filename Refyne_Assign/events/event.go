@@ -0,0 +1,41 @@
+// Package events publishes the domain events written to the outbox by the
+// storage repositories to pluggable sinks
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"../storage"
+)
+
+// Event is the published form of a domain event
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregateId"`
+	OccurredAt  time.Time       `json:"occurredAt"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// fromOutbox maps an outbox event to its published form
+func fromOutbox(event storage.OutboxEvent) Event {
+	var occurredAt time.Time
+	if event.Created != nil {
+		occurredAt = *event.Created
+	}
+	return Event{
+		ID:          event.ID,
+		Type:        string(event.Type),
+		AggregateID: event.AggregateID,
+		OccurredAt:  occurredAt,
+		Data:        json.RawMessage(event.Payload),
+	}
+}
+
+// Sink publishes events. Events are delivered at least once, so sinks may
+// see an event again after a failure and consumers should deduplicate by ID
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
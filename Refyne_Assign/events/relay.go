@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"../config"
+	"../storage"
+	"go.uber.org/zap"
+)
+
+// Relay publishes events from the outbox to a sink. An event is marked
+// published only after the sink accepts it, so every event is delivered at
+// least once; failed events are retried with exponential backoff
+type Relay struct {
+	outbox storage.OutboxRepository
+	sink   Sink
+	config config.Outbox
+	log    *zap.SugaredLogger
+}
+
+// NewRelay returns a relay publishing events from outbox to sink as
+// configured by config
+func NewRelay(config config.Outbox, outbox storage.OutboxRepository, sink Sink, log *zap.SugaredLogger) *Relay {
+	return &Relay{outbox: outbox, sink: sink, config: config, log: log}
+}
+
+// NewSink returns the sink publishing to every sink named in config
+func NewSink(config config.Outbox, log *zap.SugaredLogger) Sink {
+	var sinks MultiSink
+	for _, name := range config.Sinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, NewLogSink(log))
+		case "file":
+			sinks = append(sinks, NewFileSink(config.FilePath))
+		case "webhook":
+			sinks = append(sinks, NewWebhookSink(config.WebhookURL, config.WebhookTimeout))
+		}
+	}
+	return sinks
+}
+
+// Run publishes pending events every poll interval until ctx is done
+func (relay *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep publishing while full batches are pending, then wait. A batch
+		// with an outcome that could not be recorded also waits, rather than
+		// retrying at once against an outbox that is failing
+		for relay.RelayOnce(ctx) == relay.config.BatchSize && ctx.Err() == nil {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce claims a batch of pending events and publishes them, returning
+// how many were published or rescheduled after failing. Claimed events whose
+// outcome could not be recorded are published again once the claim times out
+func (relay *Relay) RelayOnce(ctx context.Context) int {
+	now := time.Now().UTC()
+	pending, err := relay.outbox.ClaimPendingEvents(now, relay.config.BatchSize, now.Add(relay.config.ClaimTimeout))
+	if err != nil {
+		relay.log.Errorw("Unable to fetch pending events from outbox",
+			"error", err)
+		return 0
+	}
+
+	recorded := 0
+	for _, event := range pending {
+		if ctx.Err() != nil {
+			return recorded
+		}
+		if relay.publish(ctx, event) {
+			recorded++
+		}
+	}
+	return recorded
+}
+
+// publish publishes event and records the outcome in the outbox, returning
+// whether the outcome was recorded
+func (relay *Relay) publish(ctx context.Context, event storage.OutboxEvent) bool {
+	err := relay.sink.Publish(ctx, fromOutbox(event))
+	if err == nil {
+		if err = relay.outbox.MarkEventPublished(event.ID, time.Now().UTC()); err != nil {
+			// The event stays pending and is published again
+			relay.log.Errorw("Unable to mark event published",
+				"id", event.ID,
+				"error", err)
+			return false
+		}
+		return true
+	}
+
+	next := time.Now().UTC().Add(relay.backoff(event.Attempts + 1))
+	relay.log.Warnw("Unable to publish event, will retry",
+		"id", event.ID,
+		"type", event.Type,
+		"attempts", event.Attempts+1,
+		"nextAttemptAt", next,
+		"error", err)
+
+	if err = relay.outbox.MarkEventFailed(event.ID, err.Error(), next); err != nil {
+		relay.log.Errorw("Unable to record failed attempt to publish event",
+			"id", event.ID,
+			"error", err)
+		return false
+	}
+	return true
+}
+
+// backoff returns the delay before retrying an event that failed attempts times
+func (relay *Relay) backoff(attempts int) time.Duration {
+	delay := relay.config.RetryBackoff
+	for i := 1; i < attempts && delay < relay.config.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > relay.config.MaxRetryBackoff {
+		delay = relay.config.MaxRetryBackoff
+	}
+	return delay
+}
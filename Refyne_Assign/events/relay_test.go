@@ -0,0 +1,242 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"../config"
+	"../storage"
+	"go.uber.org/zap"
+)
+
+// recordingSink records the events published to it, failing the first
+// failures attempts
+type recordingSink struct {
+	failures  int
+	published []Event
+}
+
+func (sink *recordingSink) Publish(ctx context.Context, event Event) error {
+	if sink.failures > 0 {
+		sink.failures--
+		return errors.New("sink unavailable")
+	}
+	sink.published = append(sink.published, event)
+	return nil
+}
+
+// sinkFunc publishes events by calling itself
+type sinkFunc func(ctx context.Context, event Event) error
+
+func (f sinkFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// newTestOutbox returns a store whose outbox holds an event for each of
+// changes updates of a car
+func newTestOutbox(t *testing.T, changes int) *storage.MemoryStore {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	car := storage.Car{CarLicenseNumber: "KA01AB1234", PPH: 100}
+	if err := store.CreateCar(&car); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	for i := 0; i < changes; i++ {
+		car.Version = 0
+		car.PPH++
+		if err := store.UpdateCar(&car); err != nil {
+			t.Fatalf("UpdateCar: %v", err)
+		}
+	}
+	return store
+}
+
+// testOutboxConfig retries failed events a minute later, and events not
+// marked an hour after they were claimed
+var testOutboxConfig = config.Outbox{BatchSize: 10, ClaimTimeout: time.Hour, RetryBackoff: time.Minute, MaxRetryBackoff: time.Hour}
+
+func TestRelayOncePublishes(t *testing.T) {
+	store := newTestOutbox(t, 3)
+	sink := &recordingSink{}
+	relay := NewRelay(testOutboxConfig, store, sink, zap.NewNop().Sugar())
+
+	if n := relay.RelayOnce(context.Background()); n != 3 {
+		t.Fatalf("attempted %d events, want 3", n)
+	}
+	if len(sink.published) != 3 || sink.published[0].Type != string(storage.EventCarUpdated) {
+		t.Fatalf("published %+v, want the 3 car updates", sink.published)
+	}
+
+	// Published events are not published again
+	if n := relay.RelayOnce(context.Background()); n != 0 {
+		t.Errorf("attempted %d events once published, want 0", n)
+	}
+}
+
+func TestRelayOnceRetriesFailedEvents(t *testing.T) {
+	store := newTestOutbox(t, 1)
+	sink := &recordingSink{failures: 1}
+	relay := NewRelay(testOutboxConfig, store, sink, zap.NewNop().Sugar())
+
+	before := time.Now().UTC()
+	if n := relay.RelayOnce(context.Background()); n != 1 {
+		t.Fatalf("attempted %d events, want 1", n)
+	}
+	if len(sink.published) != 0 {
+		t.Fatalf("published %+v while the sink fails", sink.published)
+	}
+
+	// The event is retried once the backoff has passed
+	due := before.Add(time.Minute + time.Second)
+	pending, _ := store.ClaimPendingEvents(due, 10, due)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError != "sink unavailable" || pending[0].NextAttemptAt.Before(before.Add(time.Minute)) {
+		t.Fatalf("got pending %+v, want the event retried a minute after failing", pending)
+	}
+	if n := relay.RelayOnce(context.Background()); n != 0 {
+		t.Errorf("attempted %d events before the retry is due, want 0", n)
+	}
+}
+
+func TestRelayOncePublishesRetries(t *testing.T) {
+	store := newTestOutbox(t, 1)
+	sink := &recordingSink{failures: 2}
+	cfg := testOutboxConfig
+	cfg.RetryBackoff, cfg.MaxRetryBackoff = time.Nanosecond, time.Nanosecond
+	relay := NewRelay(cfg, store, sink, zap.NewNop().Sugar())
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if n := relay.RelayOnce(context.Background()); n != 1 {
+			t.Fatalf("attempt %d: attempted %d events, want 1", attempt, n)
+		}
+	}
+	if len(sink.published) != 1 {
+		t.Fatalf("published %+v, want the event once the sink recovers", sink.published)
+	}
+	if n := relay.RelayOnce(context.Background()); n != 0 {
+		t.Errorf("attempted %d events once published, want 0", n)
+	}
+}
+
+// failingOutbox is an outbox that cannot record outcomes, counting the
+// batches claimed from it
+type failingOutbox struct {
+	storage.OutboxRepository
+	claims int
+}
+
+func (outbox *failingOutbox) ClaimPendingEvents(now time.Time, limit int, claimedUntil time.Time) ([]storage.OutboxEvent, error) {
+	outbox.claims++
+	return outbox.OutboxRepository.ClaimPendingEvents(now, limit, claimedUntil)
+}
+
+func (outbox *failingOutbox) MarkEventPublished(id string, at time.Time) error {
+	return errors.New("outbox unavailable")
+}
+
+func (outbox *failingOutbox) MarkEventFailed(id string, lastError string, nextAttemptAt time.Time) error {
+	return errors.New("outbox unavailable")
+}
+
+func TestRelayOnceUnrecordedOutcomes(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+	}{
+		{"mark published fails", 0},
+		{"mark failed fails", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestOutbox(t, 1)
+			sink := &recordingSink{failures: test.failures}
+			relay := NewRelay(testOutboxConfig, &failingOutbox{OutboxRepository: store}, sink, zap.NewNop().Sugar())
+
+			if n := relay.RelayOnce(context.Background()); n != 0 {
+				t.Fatalf("recorded %d outcomes, want 0", n)
+			}
+
+			// The event stays claimed until the claim times out, then is due again
+			if n := NewRelay(testOutboxConfig, store, sink, zap.NewNop().Sugar()).RelayOnce(context.Background()); n != 0 {
+				t.Errorf("claimed event relayed again by %d, want 0", n)
+			}
+			later := time.Now().UTC().Add(testOutboxConfig.ClaimTimeout + time.Second)
+			if pending, _ := store.ClaimPendingEvents(later, 10, later); len(pending) != 1 {
+				t.Errorf("got %d events due once the claim timed out, want 1", len(pending))
+			}
+		})
+	}
+}
+
+func TestRelayOnceSkipsClaimedEvents(t *testing.T) {
+	store := newTestOutbox(t, 3)
+	cfg := testOutboxConfig
+	cfg.BatchSize = 2
+	first, second := &recordingSink{}, &recordingSink{}
+
+	// A second relay polling while the first is publishing gets the rest
+	var relayed int
+	relay := NewRelay(cfg, store, sinkFunc(func(ctx context.Context, event Event) error {
+		if len(first.published) == 0 {
+			relayed = NewRelay(cfg, store, second, zap.NewNop().Sugar()).RelayOnce(ctx)
+		}
+		return first.Publish(ctx, event)
+	}), zap.NewNop().Sugar())
+
+	if n := relay.RelayOnce(context.Background()); n != 2 {
+		t.Fatalf("first relay recorded %d outcomes, want 2", n)
+	}
+	if relayed != 1 || len(second.published) != 1 {
+		t.Fatalf("second relay recorded %d outcomes and published %d events, want 1", relayed, len(second.published))
+	}
+	for _, event := range first.published {
+		if event.ID == second.published[0].ID {
+			t.Errorf("event %s published by both relays", event.ID)
+		}
+	}
+}
+
+func TestRelayRunWaitsAfterUnrecordedOutcome(t *testing.T) {
+	store := newTestOutbox(t, 1)
+	outbox := &failingOutbox{OutboxRepository: store}
+	cfg := testOutboxConfig
+	cfg.BatchSize, cfg.ClaimTimeout, cfg.PollInterval = 1, time.Nanosecond, time.Hour
+	relay := NewRelay(cfg, outbox, &recordingSink{}, zap.NewNop().Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	if outbox.claims != 1 {
+		t.Errorf("claimed %d batches before the next poll, want 1", outbox.claims)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(config.Outbox{RetryBackoff: time.Second, MaxRetryBackoff: 5 * time.Second}, nil, nil, zap.NewNop().Sugar())
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{64, 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := relay.backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
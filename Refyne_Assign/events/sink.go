@@ -0,0 +1,125 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LogSink publishes events to a log
+type LogSink struct {
+	log *zap.SugaredLogger
+}
+
+// NewLogSink returns a sink writing events to log
+func NewLogSink(log *zap.SugaredLogger) *LogSink {
+	return &LogSink{log: log}
+}
+
+// Publish logs event
+func (sink *LogSink) Publish(ctx context.Context, event Event) error {
+	sink.log.Infow("Published event "+event.Type,
+		"id", event.ID,
+		"aggregateId", event.AggregateID,
+		"occurredAt", event.OccurredAt,
+		"data", string(event.Data))
+	return nil
+}
+
+// FileSink publishes events by appending them to a file, one JSON object per line
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSink returns a sink appending events to the file at path
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// Publish appends event to the file and flushes it to disk
+func (sink *FileSink) Publish(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	file, err := os.OpenFile(sink.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WebhookSink publishes events by posting them as JSON to a URL. Any response
+// other than 2xx is a failure
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink posting events to url, giving up on a post
+// after timeout
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Publish posts event to the webhook
+func (sink *WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", event.ID)
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := sink.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", sink.url, resp.Status)
+	}
+	return nil
+}
+
+// MultiSink publishes events to every one of its sinks. An event fails, and
+// is retried on all sinks, if any sink fails
+type MultiSink []Sink
+
+// Publish publishes event to every sink, returning the first failure
+func (sinks MultiSink) Publish(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, sink := range sinks {
+		if err := sink.Publish(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -4,8 +4,11 @@ go 1.15
 
 require (
 	firebase.google.com/go/v4 v4.1.0
+	github.com/BurntSushi/toml v0.3.1
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/google/uuid v1.1.4
 	github.com/labstack/echo/v4 v4.1.17
 	go.uber.org/zap v1.16.0
+	google.golang.org/api v0.17.0
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,167 @@
+// Package otp signs callers in with one-time codes sent to their mobile
+// number by SMS, issuing a session token once a code is verified
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"time"
+
+	"../auth"
+	"../config"
+	"../storage"
+	"github.com/google/uuid"
+)
+
+// Errors returned by Service
+var (
+	// ErrInvalidCode is returned when no unexpired, unused code was sent to
+	// the number or the code does not match
+	ErrInvalidCode = errors.New("invalid or expired one-time code")
+	// ErrTooManyAttempts is returned when every attempt at the code was used
+	ErrTooManyAttempts = errors.New("too many attempts at one-time code")
+)
+
+// Session is issued to a caller verifying a one-time code
+type Session struct {
+	Token     string
+	ExpiresAt time.Time
+	// UID is the identity signed in, which users register as
+	UID string
+	// UserID is the user registered as UID, if any
+	UserID string
+}
+
+// Service sends one-time codes and verifies them
+type Service struct {
+	challenges storage.OTPRepository
+	users      storage.UserRepository
+	sender     Sender
+	signer     *auth.LocalVerifier
+	config     config.OTP
+	sessionTTL time.Duration
+	// secret keys the hashes of codes, so that stored hashes cannot be
+	// reversed by trying every code
+	secret []byte
+}
+
+// NewService returns a service sending codes with sender and signing session
+// tokens as configured by config
+func NewService(config *config.Config, store storage.Store, sender Sender) *Service {
+	return &Service{
+		challenges: store,
+		users:      store,
+		sender:     sender,
+		signer:     auth.NewSessionSigner(config.Auth),
+		config:     config.OTP,
+		sessionTTL: config.Auth.SessionTTL,
+		secret:     []byte(config.Auth.SessionSecret),
+	}
+}
+
+// Request sends a new one-time code to mobile, returning when it expires. It
+// returns storage.ErrOTPRateLimited when too many codes were sent to mobile
+func (service *Service) Request(ctx context.Context, mobile string) (time.Time, error) {
+	code, err := service.newCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	created := time.Now().UTC()
+	expiresAt := created.Add(service.config.TTL)
+	challenge := storage.OTPChallenge{
+		ID:        uuid.New().String(),
+		Mobile:    mobile,
+		Created:   &created,
+		ExpiresAt: &expiresAt,
+	}
+	challenge.CodeHash = service.hash(challenge, code)
+
+	err = service.challenges.CreateOTPChallenge(&challenge, created.Add(-service.config.RequestWindow), service.config.RequestLimit)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	message := "Your sign-in code is " + code + ". It expires in " + service.config.TTL.String() + ". Do not share it with anyone."
+	return expiresAt, service.sender.Send(ctx, mobile, message)
+}
+
+// Verify checks code against the code last sent to mobile and signs the
+// caller in. Every check counts as an attempt, whether the code matches or not
+func (service *Service) Verify(ctx context.Context, mobile string, code string) (*Session, error) {
+	now := time.Now().UTC()
+	challenge, err := service.challenges.LatestOTPChallenge(mobile)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.VerifiedAt != nil || !now.Before(*challenge.ExpiresAt) {
+		return nil, ErrInvalidCode
+	}
+
+	counted, err := service.challenges.RecordOTPAttempt(challenge.ID, service.config.MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		return nil, ErrTooManyAttempts
+	}
+
+	if !hmac.Equal([]byte(service.hash(*challenge, code)), []byte(challenge.CodeHash)) {
+		return nil, ErrInvalidCode
+	}
+
+	// Only one verification of a code signs in
+	verified, err := service.challenges.VerifyOTPChallenge(challenge.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, ErrInvalidCode
+	}
+
+	session := &Session{UID: "phone:" + mobile, ExpiresAt: now.Add(service.sessionTTL)}
+	user, err := service.users.GetUserByUID(session.UID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		session.UserID = user.ID
+	}
+
+	session.Token, err = service.signer.Sign(auth.Identity{UID: session.UID}, service.sessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// newCode returns a random code of the configured number of digits
+func (service *Service) newCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < service.config.CodeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	code := n.String()
+	for len(code) < service.config.CodeLength {
+		code = "0" + code
+	}
+	return code, nil
+}
+
+// hash returns the keyed hash of code sent for challenge
+func (service *Service) hash(challenge storage.OTPChallenge, code string) string {
+	h := hmac.New(sha256.New, service.secret)
+	h.Write([]byte(challenge.ID + "\n" + challenge.Mobile + "\n" + code))
+	return hex.EncodeToString(h.Sum(nil))
+}
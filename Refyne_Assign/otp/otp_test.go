@@ -0,0 +1,182 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"../auth"
+	"../config"
+	"../storage"
+)
+
+const (
+	testSecret = "0123456789abcdef0123456789abcdef"
+	testMobile = "+15550000001"
+)
+
+// recordingSender keeps the last code sent to each number
+type recordingSender struct {
+	codes map[string]string
+}
+
+var codePattern = regexp.MustCompile(`code is (\d+)`)
+
+func (sender *recordingSender) Send(ctx context.Context, mobile string, message string) error {
+	match := codePattern.FindStringSubmatch(message)
+	if match == nil {
+		return errors.New("no code in message " + message)
+	}
+	sender.codes[mobile] = match[1]
+	return nil
+}
+
+// newTestService returns a service over a memory store sending codes to the
+// returned sender
+func newTestService(t *testing.T, otpConfig config.OTP) (*Service, *recordingSender, *storage.MemoryStore) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	sender := &recordingSender{codes: map[string]string{}}
+	cfg := &config.Config{
+		Auth: config.Auth{SessionSecret: testSecret, SessionTTL: time.Hour},
+		OTP:  otpConfig,
+	}
+	return NewService(cfg, store, sender), sender, store
+}
+
+var testOTPConfig = config.OTP{
+	CodeLength:    6,
+	TTL:           5 * time.Minute,
+	MaxAttempts:   3,
+	RequestLimit:  2,
+	RequestWindow: time.Hour,
+}
+
+// wrongCode returns a code of the same length that is not code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestServiceVerify(t *testing.T) {
+	service, sender, store := newTestService(t, testOTPConfig)
+	ctx := context.Background()
+
+	user := storage.User{UID: "phone:" + testMobile, Mobile: testMobile}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if _, err := service.Request(ctx, testMobile); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	code := sender.codes[testMobile]
+	if len(code) != testOTPConfig.CodeLength {
+		t.Fatalf("code %q, want %d digits", code, testOTPConfig.CodeLength)
+	}
+
+	session, err := service.Verify(ctx, testMobile, code)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if session.UID != user.UID || session.UserID != user.ID {
+		t.Errorf("session of %q (user %q), want %q (user %q)", session.UID, session.UserID, user.UID, user.ID)
+	}
+
+	identity, err := auth.NewSessionSigner(config.Auth{SessionSecret: testSecret}).Verify(ctx, session.Token)
+	if err != nil {
+		t.Fatalf("session token rejected: %v", err)
+	}
+	if identity.UID != user.UID {
+		t.Errorf("session token for %q, want %q", identity.UID, user.UID)
+	}
+
+	// A code signs in once only
+	if _, err = service.Verify(ctx, testMobile, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("second Verify error %v, want %v", err, ErrInvalidCode)
+	}
+}
+
+func TestServiceVerifyRejects(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no code sent", func(t *testing.T) {
+		service, _, _ := newTestService(t, testOTPConfig)
+		if _, err := service.Verify(ctx, testMobile, "123456"); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("error %v, want %v", err, ErrInvalidCode)
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		service, sender, _ := newTestService(t, testOTPConfig)
+		if _, err := service.Request(ctx, testMobile); err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		code := sender.codes[testMobile]
+		if _, err := service.Verify(ctx, testMobile, wrongCode(code)); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("error %v, want %v", err, ErrInvalidCode)
+		}
+		// Attempts left still sign in
+		if _, err := service.Verify(ctx, testMobile, code); err != nil {
+			t.Errorf("Verify after a wrong code: %v", err)
+		}
+	})
+
+	t.Run("expired code", func(t *testing.T) {
+		expiring := testOTPConfig
+		expiring.TTL = time.Millisecond
+		service, sender, _ := newTestService(t, expiring)
+		if _, err := service.Request(ctx, testMobile); err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if _, err := service.Verify(ctx, testMobile, sender.codes[testMobile]); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("error %v, want %v", err, ErrInvalidCode)
+		}
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		service, sender, _ := newTestService(t, testOTPConfig)
+		if _, err := service.Request(ctx, testMobile); err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		code := sender.codes[testMobile]
+		for i := 0; i < testOTPConfig.MaxAttempts; i++ {
+			if _, err := service.Verify(ctx, testMobile, wrongCode(code)); !errors.Is(err, ErrInvalidCode) {
+				t.Fatalf("attempt %d error %v, want %v", i+1, err, ErrInvalidCode)
+			}
+		}
+		// Once attempts are used up even the right code is refused
+		if _, err := service.Verify(ctx, testMobile, code); !errors.Is(err, ErrTooManyAttempts) {
+			t.Errorf("error %v, want %v", err, ErrTooManyAttempts)
+		}
+	})
+}
+
+func TestServiceRequestRateLimit(t *testing.T) {
+	service, sender, _ := newTestService(t, testOTPConfig)
+	ctx := context.Background()
+
+	for i := 0; i < testOTPConfig.RequestLimit; i++ {
+		if _, err := service.Request(ctx, testMobile); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	code := sender.codes[testMobile]
+
+	if _, err := service.Request(ctx, testMobile); !errors.Is(err, storage.ErrOTPRateLimited) {
+		t.Errorf("error %v, want %v", err, storage.ErrOTPRateLimited)
+	}
+	if sender.codes[testMobile] != code {
+		t.Errorf("code sent to a rate limited number")
+	}
+
+	// Other numbers have their own limit
+	if _, err := service.Request(ctx, "+15550000002"); err != nil {
+		t.Errorf("Request to another number: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package otp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"../config"
+)
+
+// Sender sends text messages to mobile numbers
+type Sender interface {
+	Send(ctx context.Context, mobile string, message string) error
+}
+
+// NewSender returns the sender named in config
+func NewSender(config config.OTP) (Sender, error) {
+	switch config.Sender {
+	case "http":
+		return NewHTTPSender(config.SenderURL, config.SenderToken, config.SenderTimeout), nil
+	case "file":
+		return NewFileSender(config.SenderFilePath), nil
+	}
+	return nil, fmt.Errorf("otp: unknown sender %q", config.Sender)
+}
+
+// HTTPSender sends messages through an SMS gateway by posting them as JSON
+// to its URL. Any response other than 2xx is a failure
+type HTTPSender struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPSender returns a sender posting messages to the gateway at url with
+// token as bearer token, if any, giving up on a post after timeout
+func NewHTTPSender(url string, token string, timeout time.Duration) *HTTPSender {
+	return &HTTPSender{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+// gatewayMessage is the body posted to the SMS gateway
+type gatewayMessage struct {
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+// Send posts the message to the gateway
+func (sender *HTTPSender) Send(ctx context.Context, mobile string, message string) error {
+	body, err := json.Marshal(gatewayMessage{To: mobile, Message: message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sender.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(sender.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+sender.token)
+	}
+
+	resp, err := sender.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otp: SMS gateway %s responded %s", sender.url, resp.Status)
+	}
+	return nil
+}
+
+// FileSender stands in for an SMS gateway in development and tests by
+// appending messages to a file, one JSON object per line
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSender returns a sender appending messages to the file at path
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+// sentMessage is a line written by FileSender
+type sentMessage struct {
+	To      string    `json:"to"`
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+// Send appends the message to the file
+func (sender *FileSender) Send(ctx context.Context, mobile string, message string) error {
+	line, err := json.Marshal(sentMessage{To: mobile, Message: message, SentAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+
+	file, err := os.OpenFile(sender.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
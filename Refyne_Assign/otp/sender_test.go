@@ -0,0 +1,93 @@
+package otp
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"../config"
+)
+
+func TestHTTPSenderSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		wantErr bool
+	}{
+		{"accepted", "gateway-token", http.StatusAccepted, false},
+		{"without token", "", http.StatusOK, false},
+		{"rejected", "gateway-token", http.StatusTooManyRequests, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received gatewayMessage
+			var authorization string
+			gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("decoding message: %v", err)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer gateway.Close()
+
+			err := NewHTTPSender(gateway.URL, test.token, time.Second).Send(context.Background(), testMobile, "Your sign-in code is 123456.")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if received.To != testMobile || received.Message != "Your sign-in code is 123456." {
+				t.Errorf("gateway received %+v", received)
+			}
+			if want := "Bearer " + test.token; (test.token == "" && authorization != "") || (test.token != "" && authorization != want) {
+				t.Errorf("got Authorization %q", authorization)
+			}
+		})
+	}
+}
+
+func TestFileSenderSend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms.log")
+	sender := NewFileSender(path)
+	for _, message := range []string{"first", "second"} {
+		if err := sender.Send(context.Background(), testMobile, message); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading sent messages: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one per message", len(lines))
+	}
+	var sent sentMessage
+	if err = json.Unmarshal([]byte(lines[1]), &sent); err != nil || sent.To != testMobile || sent.Message != "second" {
+		t.Errorf("got last line %s, want the second message to %s", lines[1], testMobile)
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	if sender, err := NewSender(config.OTP{Sender: "http", SenderURL: "https://sms.example.com/messages", SenderTimeout: time.Second}); err != nil {
+		t.Errorf("http sender: %v", err)
+	} else if _, ok := sender.(*HTTPSender); !ok {
+		t.Errorf("got %T for the http sender", sender)
+	}
+	if sender, err := NewSender(config.OTP{Sender: "file", SenderFilePath: "sms.log"}); err != nil {
+		t.Errorf("file sender: %v", err)
+	} else if _, ok := sender.(*FileSender); !ok {
+		t.Errorf("got %T for the file sender", sender)
+	}
+	if _, err := NewSender(config.OTP{Sender: "pigeon"}); err == nil {
+		t.Errorf("got no error for an unknown sender")
+	}
+}
@@ -0,0 +1,39 @@
+package pricing
+
+import (
+	"time"
+
+	"../storage"
+)
+
+// CancellationPolicy decides how much of a booking's price is refunded when
+// it is cancelled
+type CancellationPolicy struct {
+	// FullRefundBefore is how long before the start of a booking it must be
+	// cancelled to be refunded in full
+	FullRefundBefore time.Duration
+	// PartialRefundPercent is the share of the fare refunded when a booking
+	// is cancelled later than FullRefundBefore but before it starts
+	PartialRefundPercent int
+}
+
+// Refund computes the amount refunded for cancelling booking at given time.
+// The security deposit is always returned, as a cancelled booking leaves no
+// use of the car to assess it against; only the fare is subject to the policy
+func (policy CancellationPolicy) Refund(booking storage.CarBooking, at time.Time) int {
+	return booking.Securitydeposit + policy.fareRefund(booking, at)
+}
+
+// fareRefund computes the part of the fare refunded for cancelling booking at
+// given time: all of it when cancelled FullRefundBefore its start, a share of
+// it when cancelled later but before it starts, and nothing after that
+func (policy CancellationPolicy) fareRefund(booking storage.CarBooking, at time.Time) int {
+	fare := booking.Total - booking.Securitydeposit
+	switch {
+	case booking.StartDateTime == nil || !at.Before(*booking.StartDateTime):
+		return 0
+	case booking.StartDateTime.Sub(at) >= policy.FullRefundBefore:
+		return fare
+	}
+	return fare * policy.PartialRefundPercent / 100
+}
@@ -0,0 +1,44 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"../storage"
+)
+
+func TestCancellationPolicyRefund(t *testing.T) {
+	policy := CancellationPolicy{FullRefundBefore: 24 * time.Hour, PartialRefundPercent: 50}
+	start := time.Date(2021, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	// The fare is 1000 and the security deposit 150
+	tests := []struct {
+		name   string
+		before time.Duration
+		want   int
+	}{
+		{"well ahead", 48 * time.Hour, 1150},
+		{"just in time for full refund", 24 * time.Hour, 1150},
+		{"late", 12 * time.Hour, 650},
+		{"at start", 0, 150},
+		{"after start", -2 * time.Hour, 150},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			booking := storage.CarBooking{StartDateTime: &start, Securitydeposit: 150, Total: 1150}
+			if got := policy.Refund(booking, start.Add(-test.before)); got != test.want {
+				t.Errorf("Refund = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCancellationPolicyRefundWithoutStart(t *testing.T) {
+	policy := CancellationPolicy{FullRefundBefore: 24 * time.Hour, PartialRefundPercent: 50}
+	booking := storage.CarBooking{Securitydeposit: 150, Total: 1150}
+
+	if got := policy.Refund(booking, time.Now()); got != 150 {
+		t.Errorf("Refund = %d, want the deposit of 150", got)
+	}
+}
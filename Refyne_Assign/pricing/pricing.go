@@ -0,0 +1,148 @@
+package pricing
+
+import (
+	"errors"
+	"time"
+
+	"../storage"
+)
+
+const defaultBillingGranularity = time.Hour
+
+// ErrInvalidWindow is returned when the rental window does not end after it starts
+var ErrInvalidWindow = errors.New("rental window must end after it starts")
+
+// Config holds the settings used to price a rental
+type Config struct {
+	// BillingGranularity is the unit the rented duration is rounded up to
+	BillingGranularity time.Duration
+	// TaxRate is the tax levied on the fare, in basis points
+	TaxRate int
+}
+
+// Quote represents an itemised price for renting a car for a window
+type Quote struct {
+	CarID           string
+	StartDateTime   time.Time
+	EndDateTime     time.Time
+	BilledDuration  time.Duration
+	BaseFare        int
+	HourlyRate      int
+	HourlyCharge    int
+	Discount        int
+	SecurityDeposit int
+	Taxes           int
+	Total           int
+	// CarVersion is the version of the car the quote was priced at
+	CarVersion int
+}
+
+// Engine prices car rentals
+type Engine struct {
+	config Config
+	cars   storage.CarRepository
+}
+
+// NewEngine returns a pricing engine using given configuration that looks
+// cars up in cars
+func NewEngine(config Config, cars storage.CarRepository) *Engine {
+	if config.BillingGranularity <= 0 {
+		config.BillingGranularity = defaultBillingGranularity
+	}
+	return &Engine{config: config, cars: cars}
+}
+
+// Quote prices renting the car with given id for a window. It returns
+// storage.ErrCarNotFound when no such car exists and
+// storage.ErrCarUnavailable when the car is retired
+func (engine *Engine) Quote(carID string, from time.Time, to time.Time) (*Quote, error) {
+	car, err := engine.cars.GetCar(carID)
+	if err != nil {
+		return nil, err
+	}
+
+	if car == nil {
+		return nil, storage.ErrCarNotFound
+	}
+
+	if car.Retired {
+		return nil, storage.ErrCarUnavailable
+	}
+
+	quote, err := engine.Price(*car, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// Price prices renting given car for a window
+func (engine *Engine) Price(car storage.Car, from time.Time, to time.Time) (Quote, error) {
+	var quote Quote
+	if !to.After(from) {
+		return quote, ErrInvalidWindow
+	}
+
+	quote.CarID = car.ID
+	quote.CarVersion = car.Version
+	quote.StartDateTime = from
+	quote.EndDateTime = to
+	quote.BilledDuration = engine.billedDuration(to.Sub(from))
+	quote.BaseFare = car.BasePrice
+	quote.HourlyRate = car.PPH
+	quote.HourlyCharge = hourlyCharge(car.PPH, quote.BilledDuration)
+	quote.SecurityDeposit = car.Securitydeposit
+	fare := quote.BaseFare + quote.HourlyCharge - quote.Discount
+	quote.Taxes = engine.taxes(fare)
+	quote.Total = fare + quote.Taxes + quote.SecurityDeposit
+
+	return quote, nil
+}
+
+// ApplyTo records the quoted price on booking as its price snapshot, on
+// condition of the car version it was quoted at
+func (quote Quote) ApplyTo(booking *storage.CarBooking) {
+	booking.CarVersion = quote.CarVersion
+	booking.BasePrice = quote.BaseFare
+	booking.PPH = quote.HourlyRate
+	booking.HourlyCharge = quote.HourlyCharge
+	booking.Securitydeposit = quote.SecurityDeposit
+	booking.Discount = quote.Discount
+	booking.Taxes = quote.Taxes
+	booking.Total = quote.Total
+}
+
+// Adjustment prices moving the end of booking to end at the car's hourly
+// rate. The billed duration before and after the change are both rounded to
+// the billing granularity; the amount is negative for an early return
+func (engine *Engine) Adjustment(booking storage.CarBooking, car storage.Car, end time.Time) int {
+	previous := engine.billedDuration(booking.EndDateTime.Sub(*booking.StartDateTime))
+	changed := engine.billedDuration(end.Sub(*booking.StartDateTime))
+
+	delta := changed - previous
+	sign := 1
+	if delta < 0 {
+		sign, delta = -1, -delta
+	}
+
+	charge := hourlyCharge(car.PPH, delta)
+	return sign * (charge + engine.taxes(charge))
+}
+
+// billedDuration rounds duration up to the billing granularity
+func (engine *Engine) billedDuration(duration time.Duration) time.Duration {
+	granularity := engine.config.BillingGranularity
+	units := (duration + granularity - 1) / granularity
+	return units * granularity
+}
+
+// taxes computes tax on fare, rounding half up
+func (engine *Engine) taxes(fare int) int {
+	return (fare*engine.config.TaxRate + 5000) / 10000
+}
+
+// hourlyCharge computes charge for duration at the hourly rate, rounding half up
+func hourlyCharge(rate int, duration time.Duration) int {
+	seconds := int64(duration / time.Second)
+	return int((int64(rate)*seconds + 1800) / 3600)
+}
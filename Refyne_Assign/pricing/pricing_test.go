@@ -0,0 +1,116 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"../storage"
+)
+
+func TestEnginePrice(t *testing.T) {
+	car := storage.Car{ID: "car-1", BasePrice: 500, PPH: 100, Securitydeposit: 1000, Version: 3}
+	from := time.Date(2021, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	// The fare is taxed at 10%, rounding half up
+	tests := []struct {
+		name        string
+		granularity time.Duration
+		rented      time.Duration
+		billed      time.Duration
+		hourly      int
+		taxes       int
+		total       int
+	}{
+		{"whole hours", time.Hour, 2 * time.Hour, 2 * time.Hour, 200, 70, 1770},
+		{"part of an hour rounded up", time.Hour, 90 * time.Minute, 2 * time.Hour, 200, 70, 1770},
+		{"a minute into the next hour", time.Hour, time.Hour + time.Minute, 2 * time.Hour, 200, 70, 1770},
+		{"quarter hours", 15 * time.Minute, 70 * time.Minute, 75 * time.Minute, 125, 63, 1688},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := NewEngine(Config{BillingGranularity: test.granularity, TaxRate: 1000}, nil)
+			quote, err := engine.Price(car, from, from.Add(test.rented))
+			if err != nil {
+				t.Fatalf("Price: %v", err)
+			}
+			if quote.CarID != car.ID || quote.CarVersion != 3 || quote.BaseFare != 500 || quote.HourlyRate != 100 || quote.SecurityDeposit != 1000 {
+				t.Errorf("got quote %+v, want car-1 version 3 at base fare 500, rate 100 and deposit 1000", quote)
+			}
+			if quote.BilledDuration != test.billed || quote.HourlyCharge != test.hourly || quote.Taxes != test.taxes || quote.Total != test.total {
+				t.Errorf("got %v billed, hourly charge %d, taxes %d, total %d, want %v, %d, %d, %d",
+					quote.BilledDuration, quote.HourlyCharge, quote.Taxes, quote.Total, test.billed, test.hourly, test.taxes, test.total)
+			}
+		})
+	}
+}
+
+func TestEnginePriceInvalidWindow(t *testing.T) {
+	engine := NewEngine(Config{BillingGranularity: time.Hour}, nil)
+	from := time.Date(2021, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	for _, to := range []time.Time{from, from.Add(-time.Hour)} {
+		if _, err := engine.Price(storage.Car{PPH: 100}, from, to); err != ErrInvalidWindow {
+			t.Errorf("pricing %v to %v: got error %v, want ErrInvalidWindow", from, to, err)
+		}
+	}
+}
+
+func TestEngineAdjustment(t *testing.T) {
+	engine := NewEngine(Config{BillingGranularity: time.Hour, TaxRate: 1000}, nil)
+	start := time.Date(2021, 3, 10, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	booking := storage.CarBooking{StartDateTime: &start, EndDateTime: &end}
+	car := storage.Car{PPH: 100}
+
+	// Every hour billed is charged 100 and taxed 10
+	tests := []struct {
+		name string
+		end  time.Duration
+		want int
+	}{
+		{"extend an hour", 3 * time.Hour, 110},
+		{"extend part of an hour", 2*time.Hour + 30*time.Minute, 110},
+		{"extend two hours", 4 * time.Hour, 220},
+		{"return an hour early", time.Hour, -110},
+		{"return early within the billed hour", time.Hour + 30*time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := engine.Adjustment(booking, car, start.Add(test.end)); got != test.want {
+				t.Errorf("Adjustment = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEngineQuote(t *testing.T) {
+	store := storage.NewMemoryStore()
+	car := storage.Car{CarLicenseNumber: "KA01AB1234", BasePrice: 500, PPH: 100, Securitydeposit: 1000}
+	if err := store.CreateCar(&car); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	engine := NewEngine(Config{BillingGranularity: time.Hour, TaxRate: 1000}, store)
+	from := time.Date(2021, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	quote, err := engine.Quote(car.ID, from, from.Add(90*time.Minute))
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	// Two hours are billed: fare 500 + 200, taxed 70, with the deposit of 1000
+	if quote.BilledDuration != 2*time.Hour || quote.Taxes != 70 || quote.Total != 1770 || quote.CarVersion != car.Version {
+		t.Errorf("got quote %+v, want 2h billed, taxes 70, total 1770 at car version %d", quote, car.Version)
+	}
+
+	if _, err = engine.Quote("missing", from, from.Add(time.Hour)); err != storage.ErrCarNotFound {
+		t.Errorf("quoting a missing car: got error %v, want ErrCarNotFound", err)
+	}
+
+	if err = store.RetireCar(car.ID, 0); err != nil {
+		t.Fatalf("RetireCar: %v", err)
+	}
+	if _, err = engine.Quote(car.ID, from, from.Add(time.Hour)); err != storage.ErrCarUnavailable {
+		t.Errorf("quoting a retired car: got error %v, want ErrCarUnavailable", err)
+	}
+}
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"../auth"
+	"../storage"
+	"github.com/labstack/echo/v4"
+)
+
+// authenticate returns middleware that admits requests carrying a bearer
+// token accepted by verifier. The verified identity, with the user the
+// caller is registered as and the role of that user, is attached to the
+// request context. Roles come from the account only, never from the token
+func authenticate(verifier auth.Verifier, users storage.UserRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var errResp ErrorResponseData
+
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+			if !strings.HasPrefix(header, "Bearer ") || len(token) == 0 {
+				return unauthorized(c, "Request must carry a bearer token in the Authorization header")
+			}
+
+			ctx := c.Request().Context()
+			identity, err := verifier.Verify(ctx, token)
+			if err != nil {
+				return unauthorized(c, "Bearer token is invalid or expired")
+			}
+
+			user, err := users.GetUserByUID(identity.UID)
+			if err != nil {
+				errResp.Data.Code = "get_account_error"
+				errResp.Data.Description = "Unable to fetch account of caller"
+				errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+				return c.JSON(http.StatusInternalServerError, errResp)
+			}
+			if user != nil {
+				identity.UserID = user.ID
+				identity.Role = user.Role
+			}
+
+			c.SetRequest(c.Request().WithContext(auth.NewContext(ctx, identity)))
+			return next(c)
+		}
+	}
+}
+
+// allow returns middleware admitting callers holding one of roles
+func allow(roles ...storage.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !callerOf(c).Holds(roles...) {
+				return forbidden(c, "Callers need one of the roles "+roleList(roles)+" to "+c.Request().Method+" "+c.Path())
+			}
+			return next(c)
+		}
+	}
+}
+
+// selfOr returns middleware admitting the user of the id path parameter and
+// callers holding one of roles
+func (h *handler) selfOr(roles ...storage.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			caller := callerOf(c)
+			if !caller.Holds(roles...) && (len(caller.UserID) == 0 || caller.UserID != strings.TrimSpace(c.Param("id"))) {
+				return forbidden(c, "Callers may only act on their own account unless they hold one of the roles "+roleList(roles))
+			}
+			return next(c)
+		}
+	}
+}
+
+// bookingOwnerOr returns middleware admitting the user who made the booking
+// of the id path parameter and callers holding one of roles
+func (h *handler) bookingOwnerOr(roles ...storage.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var errResp ErrorResponseData
+
+			caller := callerOf(c)
+			if caller.Holds(roles...) {
+				return next(c)
+			}
+
+			booking, err := h.bookings.GetBooking(strings.TrimSpace(c.Param("id")))
+			if err != nil {
+				errResp.Data.Code = "get_booking_error"
+				errResp.Data.Description = "Unable to fetch booking details"
+				errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+				return c.JSON(http.StatusInternalServerError, errResp)
+			}
+
+			// A missing booking is reported by the handler
+			if booking != nil && (len(caller.UserID) == 0 || booking.UserID != caller.UserID) {
+				return forbidden(c, "Callers may only act on their own bookings unless they hold one of the roles "+roleList(roles))
+			}
+			return next(c)
+		}
+	}
+}
+
+// roleList names roles for error descriptions
+func roleList(roles []storage.Role) string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return strings.Join(names, ", ")
+}
+
+// callerOf returns the identity of the authenticated caller
+func callerOf(c echo.Context) auth.Identity {
+	identity, _ := auth.FromContext(c.Request().Context())
+	return identity
+}
+
+func unauthorized(c echo.Context, description string) error {
+	var errResp ErrorResponseData
+	errResp.Data.Code = "unauthorized"
+	errResp.Data.Description = description
+	errResp.Data.Status = strconv.Itoa(http.StatusUnauthorized)
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	return c.JSON(http.StatusUnauthorized, errResp)
+}
+
+func forbidden(c echo.Context, description string) error {
+	var errResp ErrorResponseData
+	errResp.Data.Code = "forbidden"
+	errResp.Data.Description = description
+	errResp.Data.Status = strconv.Itoa(http.StatusForbidden)
+	return c.JSON(http.StatusForbidden, errResp)
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"../auth"
+	"../config"
+	"../otp"
+	"../storage"
+	"github.com/labstack/echo/v4"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// newTestServer returns the routes served over a memory store holding the
+// customers alice and bob and the admin carol, signed in with signer
+func newTestServer(t *testing.T) (e *echo.Echo, signer *auth.LocalVerifier, users map[string]storage.User) {
+	t.Helper()
+	cfg, err := config.Load([]string{
+		"-db-username", "u", "-db-password", "p", "-db-hostname", "h", "-db-name", "n",
+		"-auth-provider", "local", "-auth-local-secret", testSecret, "-auth-session-secret", testSecret,
+		"-otp-sender-file-path", filepath.Join(t.TempDir(), "sms.log"),
+	}, config.ServerSections...)
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+
+	store := storage.NewMemoryStore()
+	users = map[string]storage.User{}
+	for _, user := range []storage.User{
+		{UID: "uid-alice", Mobile: "+15550000001", Role: storage.RoleCustomer},
+		{UID: "uid-bob", Mobile: "+15550000002", Role: storage.RoleCustomer},
+		{UID: "uid-carol", Mobile: "+15550000003", Role: storage.RoleAdmin},
+	} {
+		if err = store.CreateUser(&user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		users[user.UID] = user
+	}
+
+	signer = auth.NewLocalVerifier(cfg.Auth.LocalSecret, cfg.Auth.LocalIssuer)
+	sender, err := otp.NewSender(cfg.OTP)
+	if err != nil {
+		t.Fatalf("otp.NewSender: %v", err)
+	}
+	return InitRoutes(cfg, store, auth.Verifiers{signer}, sender), signer, users
+}
+
+func TestAuthorization(t *testing.T) {
+	e, signer, users := newTestServer(t)
+	bearer := func(signer *auth.LocalVerifier, identity auth.Identity, ttl time.Duration) string {
+		token, err := signer.Sign(identity, ttl)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return "Bearer " + token
+	}
+	alice := bearer(signer, auth.Identity{UID: "uid-alice"}, time.Hour)
+	carol := bearer(signer, auth.Identity{UID: "uid-carol"}, time.Hour)
+	aliceAccount := "/v1/user/" + users["uid-alice"].ID
+	bobAccount := "/v1/user/" + users["uid-bob"].ID
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"missing token", aliceAccount, "", http.StatusUnauthorized},
+		{"not a bearer token", aliceAccount, "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized},
+		{"expired token", aliceAccount, bearer(signer, auth.Identity{UID: "uid-alice"}, -time.Minute), http.StatusUnauthorized},
+		{"token signed with another key", aliceAccount, bearer(auth.NewLocalVerifier("fedcba9876543210fedcba9876543210", "account-service"), auth.Identity{UID: "uid-alice"}, time.Hour), http.StatusUnauthorized},
+		{"own account", aliceAccount, alice, http.StatusOK},
+		{"another user's account", bobAccount, alice, http.StatusForbidden},
+		{"another user's bookings", bobAccount + "/bookings", alice, http.StatusForbidden},
+		{"admin on another user's account", bobAccount, carol, http.StatusOK},
+		{"admin role claimed by token", bobAccount, bearer(signer, auth.Identity{UID: "uid-alice", Role: storage.RoleAdmin}, time.Hour), http.StatusForbidden},
+		{"customer on admin route", "/v1/webhooks", alice, http.StatusForbidden},
+		{"admin on admin route", "/v1/webhooks", carol, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if len(test.authorization) > 0 {
+				req.Header.Set(echo.HeaderAuthorization, test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != test.want {
+				t.Fatalf("GET %s: got status %d, want %d: %s", test.path, rec.Code, test.want, rec.Body.String())
+			}
+			if test.want == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) != "Bearer" {
+				t.Errorf("got WWW-Authenticate %q, want Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+			}
+		})
+	}
+}
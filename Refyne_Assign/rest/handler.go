@@ -1,23 +1,77 @@
 package rest
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"../carimport"
+	"../config"
+	"../otp"
+	"../pricing"
 	"../storage"
+	"../validation"
 	"github.com/labstack/echo/v4"
 )
 
+// bookingQuoteAttempts is how many times bookCar quotes and books a car that
+// keeps being changed between the two before giving up
+const bookingQuoteAttempts = 3
+
+// handler serves the REST API from the repositories it is given
+type handler struct {
+	users    storage.UserRepository
+	licences storage.LicenceRepository
+	cars     storage.CarRepository
+	bookings storage.BookingRepository
+	webhooks storage.WebhookRepository
+	checker  storage.HealthChecker
+	// pricer prices car rentals for calculatePrice and bookCar
+	pricer *pricing.Engine
+	// cancellation decides refunds of cancelled bookings
+	cancellation pricing.CancellationPolicy
+	// importer validates and creates cars in bulk for importCars
+	importer *carimport.Importer
+	// otp signs callers in with one-time codes
+	otp *otp.Service
+}
+
+// newHandler returns a handler serving from store as configured by config,
+// sending one-time codes with sender
+func newHandler(config *config.Config, store storage.Store, sender otp.Sender) *handler {
+	pricingConfig := pricing.Config{
+		BillingGranularity: config.Pricing.BillingGranularity,
+		TaxRate:            config.Pricing.TaxRate,
+	}
+	return &handler{
+		users:    store,
+		licences: store,
+		cars:     store,
+		bookings: store,
+		webhooks: store,
+		checker:  store,
+		pricer:   pricing.NewEngine(pricingConfig, store),
+		cancellation: pricing.CancellationPolicy{
+			FullRefundBefore:     config.Cancellation.FullRefundBefore,
+			PartialRefundPercent: config.Cancellation.PartialRefundPercent,
+		},
+		importer: carimport.NewImporter(store),
+		otp:      otp.NewService(config, store, sender),
+	}
+}
+
 // index is a handler function
-func index(c echo.Context) error {
+func (h *handler) index(c echo.Context) error {
 	return c.String(http.StatusOK, "Account service")
 }
 
 // health is a handler function
-func health(c echo.Context) error {
+func (h *handler) health(c echo.Context) error {
 	var errResp ErrorResponseData
-	err := storage.Health()
+	err := h.checker.Health()
 	if err != nil {
 		errResp.Data.Code = "database_connection_error"
 		errResp.Data.Description = err.Error()
@@ -28,7 +82,7 @@ func health(c echo.Context) error {
 }
 
 // createUser is a handler function for creating a new account
-func createUser(c echo.Context) error {
+func (h *handler) createUser(c echo.Context) error {
 	var errResp ErrorResponseData
 	var resp UserResponseData
 
@@ -40,8 +94,21 @@ func createUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	// The account is registered to the caller
 	user := req.mapToModel()
-	err := storage.CreateUser(&user)
+	user.UID = callerOf(c).UID
+	err := h.users.CreateUser(&user)
+
+	if errors.Is(err, storage.ErrUserAlreadyRegistered) {
+		errResp.Data.Code = "user_already_registered"
+		errResp.Data.Description = "An account is already registered to the caller"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
 
 	if err != nil {
 		errResp.Data.Code = "create_account_error"
@@ -54,12 +121,12 @@ func createUser(c echo.Context) error {
 	return c.JSON(http.StatusCreated, resp)
 }
 
-//addCars is a Handler Function to add Cars
-func addCars(c echo.Context) error {
+// addCars is a Handler Function to add Cars
+func (h *handler) addCars(c echo.Context) error {
 	var errResp ErrorResponseData
-	var resp UserResponseData
+	var resp CarResponseData
 
-	req := new(userRequest)
+	req := new(carRequest)
 	if err := c.Bind(req); err != nil {
 		errResp.Data.Code = "request_binding_error"
 		errResp.Data.Description = "Unable to bind request"
@@ -67,143 +134,294 @@ func addCars(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	account := req.mapToModel()
-	err := storage.CreateUser(&account)
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	car := req.DAO()
+	err := h.cars.CreateCar(&car)
+
+	var duplicate *storage.DuplicateLicenseError
+	if errors.As(err, &duplicate) {
+		errResp.Data.Code = "duplicate_license"
+		errResp.Data.Description = duplicate.Error()
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
 
 	if err != nil {
-		errResp.Data.Code = "create_account_error"
-		errResp.Data.Description = "Unable to create account"
+		errResp.Data.Code = "create_car_error"
+		errResp.Data.Description = "Unable to create car"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	resp.mapFromModel(account)
+	resp.mapFromModel(car)
+	setETag(c, car.Version)
 	return c.JSON(http.StatusCreated, resp)
 }
 
-// getAccount is a handler function for fetching account based on id
-func getAccount(c echo.Context) error {
+// getCar is a handler function for fetching a car based on id
+func (h *handler) getCar(c echo.Context) error {
 	var errResp ErrorResponseData
-	var resp UserResponseData
+	var resp CarResponseData
 
 	id := strings.TrimSpace(c.Param("id"))
-	if len(id) == 0 {
-		errResp.Data.Code = "invalid_param_error"
-		errResp.Data.Description = "Value for account id not set in request"
-		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
-		return c.JSON(http.StatusBadRequest, errResp)
-	}
-
-	account, err := storage.GetAccount(id)
+	car, err := h.cars.GetCar(id)
 
 	if err != nil {
-		errResp.Data.Code = "get_account_error"
-		errResp.Data.Description = "Unable to fetch account details"
+		errResp.Data.Code = "get_car_error"
+		errResp.Data.Description = "Unable to fetch car details"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	if account == nil {
-		errResp.Data.Code = "no_account_found"
-		errResp.Data.Description = "No account with id " + id + " exists"
+	if car == nil {
+		errResp.Data.Code = "no_car_found"
+		errResp.Data.Description = "No car with id " + id + " exists"
 		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
 		return c.JSON(http.StatusNotFound, errResp)
 	}
-	resp.mapFromModel(account)
 
+	resp.mapFromModel(*car)
+	setETag(c, car.Version)
 	return c.JSON(http.StatusOK, resp)
 }
 
-// listAccounts is a handler for listing accounts in paginated format
-func listAccounts(c echo.Context) error {
+// listCars is a handler function for listing cars, filtered by the query
+// parameters manufacturer, model, minPrice and maxPrice (price per hour),
+// available and retired
+func (h *handler) listCars(c echo.Context) error {
 	var errResp ErrorResponseData
-	var resp AccountListResponseData
-
-	fromDateTime, err := strconv.Atoi(c.Param("dromDateTime"))
+	var resp CarListResponseData
 
-	if (err != nil) || (fromDateTime <= 0) {
-		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value   in query parameter fromDateTime"
-		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
-		return c.JSON(http.StatusBadRequest, errResp)
-	}
-	toDateTime, err := strconv.Atoi(c.Param("toDateTime"))
-
-	if (err != nil) || (toDateTime <= 0) || toDateTime < fromDateTime {
+	filter, err := queryCarFilter(c)
+	if err != nil {
 		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value "
+		errResp.Data.Description = err.Error()
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	totalItems, accounts, err := storage.GetAccountList(fromDateTime, toDateTime)
+	cars, err := h.cars.ListCars(filter)
 
 	if err != nil {
-		errResp.Data.Code = "error"
-		errResp.Data.Description = "Unable to fetch list "
+		errResp.Data.Code = "list_cars_error"
+		errResp.Data.Description = "Unable to fetch cars"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	for _, account := range accounts {
-		var respAccount UserResponseData
-		respAccount.mapFromModel(account)
-		resp.Data = append(resp.Data, respAccount.Data)
+	resp.Data = []CarResponse{}
+	for _, car := range cars {
+		var respCar CarResponseData
+		respCar.mapFromModel(car)
+		resp.Data = append(resp.Data, respCar.Data)
 	}
 
 	pageSize := 10
-	resp.Meta.TotalPages = (totalItems / pageSize) + 1
+	resp.Meta.TotalPages = (len(cars) / pageSize) + 1
 
 	return c.JSON(http.StatusOK, resp)
 }
 
-// listAccounts is a handler for listing accounts in paginated format
-func calculatePrice(c echo.Context) error {
+// queryCarFilter reads the car list filter from query parameters
+func queryCarFilter(c echo.Context) (storage.CarFilter, error) {
+	var filter storage.CarFilter
+	filter.Manufacturer = strings.TrimSpace(c.QueryParam("manufacturer"))
+	filter.Model = strings.TrimSpace(c.QueryParam("model"))
+
+	var err error
+	if value := c.QueryParam("minPrice"); len(value) > 0 {
+		if filter.MinPPH, err = strconv.Atoi(value); err != nil || filter.MinPPH < 0 {
+			return filter, errors.New("Invalid value in query parameter minPrice")
+		}
+	}
+	if value := c.QueryParam("maxPrice"); len(value) > 0 {
+		if filter.MaxPPH, err = strconv.Atoi(value); err != nil || filter.MaxPPH < filter.MinPPH {
+			return filter, errors.New("Invalid value in query parameter maxPrice")
+		}
+	}
+	if value := c.QueryParam("available"); len(value) > 0 {
+		available, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("Invalid value in query parameter available")
+		}
+		filter.Available = &available
+	}
+	if value := c.QueryParam("retired"); len(value) > 0 {
+		if filter.IncludeRetired, err = strconv.ParseBool(value); err != nil {
+			return filter, errors.New("Invalid value in query parameter retired")
+		}
+	}
+	return filter, nil
+}
+
+// updateCar is a handler function for partially updating a car with a JSON
+// merge patch
+func (h *handler) updateCar(c echo.Context) error {
 	var errResp ErrorResponseData
-	var resp AccountListResponseData
+	var resp CarResponseData
 
-	fromDateTime, err := strconv.Atoi(c.Param("fromDateTime"))
+	id := strings.TrimSpace(c.Param("id"))
 
-	if (err != nil) || (fromDateTime <= 0) {
-		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value   in query parameter fromDateTime"
+	var patch carPatch
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil || patch == nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Request body must be a JSON merge patch object"
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
-	toDateTime, err := strconv.Atoi(c.Param("toDateTime"))
 
-	if (err != nil) || (toDateTime <= 0) || toDateTime < fromDateTime {
-		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value "
+	car, err := h.cars.GetCar(id)
+	if err != nil {
+		errResp.Data.Code = "get_car_error"
+		errResp.Data.Description = "Unable to fetch car details"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if car == nil {
+		errResp.Data.Code = "no_car_found"
+		errResp.Data.Description = "No car with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	// The car is changed on condition of the version read, so that a
+	// concurrent change is not overwritten
+	if expected := ifMatch(c); expected != 0 && expected != car.Version {
+		return versionMismatchError(c, id)
+	}
+
+	if err = patch.applyTo(car); err != nil {
+		errResp.Data.Code = "invalid_car"
+		errResp.Data.Description = err.Error()
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	totalItems, accounts, err := storage.GetAccountList(fromDateTime, toDateTime)
+	if err = c.Validate(newCarRequest(*car)); err != nil {
+		return validationError(c, err)
+	}
+
+	err = h.cars.UpdateCar(car)
+
+	var duplicate *storage.DuplicateLicenseError
+	var mismatch *storage.VersionMismatchError
+	switch {
+	case errors.As(err, &duplicate):
+		errResp.Data.Code = "duplicate_license"
+		errResp.Data.Description = duplicate.Error()
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	case errors.As(err, &mismatch):
+		return versionMismatchError(c, id)
+	case errors.Is(err, storage.ErrCarNotFound):
+		errResp.Data.Code = "no_car_found"
+		errResp.Data.Description = "No car with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	case err != nil:
+		errResp.Data.Code = "update_car_error"
+		errResp.Data.Description = "Unable to update car"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
 
-	if err != nil {
-		errResp.Data.Code = "error"
-		errResp.Data.Description = "Unable to fetch list "
+	resp.mapFromModel(*car)
+	setETag(c, car.Version)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// retireCar is a handler function for soft-retiring a car that has no
+// bookings which have not ended
+func (h *handler) retireCar(c echo.Context) error {
+	var errResp ErrorResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	err := h.cars.RetireCar(id, ifMatch(c))
+
+	var mismatch *storage.VersionMismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		return versionMismatchError(c, id)
+	case errors.Is(err, storage.ErrCarNotFound):
+		errResp.Data.Code = "no_car_found"
+		errResp.Data.Description = "No car with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	case errors.Is(err, storage.ErrCarHasFutureBookings):
+		errResp.Data.Code = "car_has_future_bookings"
+		errResp.Data.Description = "Car " + id + " has bookings that have not ended"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	case err != nil:
+		errResp.Data.Code = "retire_car_error"
+		errResp.Data.Description = "Unable to retire car"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	for _, account := range accounts {
-		var respAccount UserResponseData
-		respAccount.mapFromModel(account)
-		resp.Data = append(resp.Data, respAccount.Data)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// importCars is a handler function for adding cars in bulk from a CSV
+// (Content-Type text/csv) or JSON array body. Cars are only created if every
+// row is valid; with query dryRun=true they are only validated
+func (h *handler) importCars(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp CarImportResponseData
+
+	dryRun, err := strconv.ParseBool(c.QueryParam("dryRun"))
+	if err != nil && len(c.QueryParam("dryRun")) > 0 {
+		errResp.Data.Code = "invalid_param_error"
+		errResp.Data.Description = "Value for dryRun must be true or false"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	format := carimport.FormatJSON
+	if contentType := c.Request().Header.Get(echo.HeaderContentType); len(contentType) > 0 {
+		format, err = carimport.ParseFormat(contentType)
+		if err != nil {
+			errResp.Data.Code = "unsupported_media_type"
+			errResp.Data.Description = err.Error()
+			errResp.Data.Status = strconv.Itoa(http.StatusUnsupportedMediaType)
+			return c.JSON(http.StatusUnsupportedMediaType, errResp)
+		}
 	}
 
-	pageSize := 10
-	resp.Meta.TotalPages = (totalItems / pageSize) + 1
+	rows, parseErrors, err := carimport.Parse(c.Request().Body, format)
+	if err != nil {
+		errResp.Data.Code = "malformed_import"
+		errResp.Data.Description = err.Error()
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
 
-	return c.JSON(http.StatusOK, resp)
+	result, err := h.importer.Import(rows, parseErrors, dryRun)
+	if err != nil {
+		errResp.Data.Code = "import_cars_error"
+		errResp.Data.Description = "Unable to import cars"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromResult(*result)
+	switch {
+	case len(result.Errors) > 0:
+		return c.JSON(http.StatusUnprocessableEntity, resp)
+	case dryRun:
+		return c.JSON(http.StatusOK, resp)
+	}
+	return c.JSON(http.StatusCreated, resp)
 }
 
-// listUserBookings is a handler for listing bookings of a user in paginated format
-func listUserBookings(c echo.Context) error {
+// getAccount is a handler function for fetching account based on id
+func (h *handler) getAccount(c echo.Context) error {
 	var errResp ErrorResponseData
-	var resp AccountListResponseData
+	var resp UserResponseData
 
 	id := strings.TrimSpace(c.Param("id"))
 	if len(id) == 0 {
@@ -213,141 +431,1127 @@ func listUserBookings(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	//change here
-	totalItems, bookings, err := storage.GetBookingList(fromDateTime, toDateTime)
+	account, err := h.users.GetAccount(id)
 
 	if err != nil {
-		errResp.Data.Code = "error"
-		errResp.Data.Description = "Unable to fetch list "
+		errResp.Data.Code = "get_account_error"
+		errResp.Data.Description = "Unable to fetch account details"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	for _, account := range bookings {
-		var respAccount UserResponseData
-		respAccount.mapFromModel(account)
-		resp.Data = append(resp.Data, respAccount.Data)
+	if account == nil {
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
 	}
+	resp.mapFromModel(*account)
+	setETag(c, account.Version)
 
-	pageSize := 10
-	resp.Meta.TotalPages = (totalItems / pageSize) + 1
+	return c.JSON(http.StatusOK, resp)
+}
+
+// updateUser is a handler function for changing the profile of an account
+// with a JSON merge patch of its mobile number, name and email
+func (h *handler) updateUser(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp UserResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+
+	var patch userPatch
+	if err := json.NewDecoder(c.Request().Body).Decode(&patch); err != nil || patch == nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Request body must be a JSON merge patch object"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	account, err := h.users.GetAccount(id)
+	if err != nil {
+		errResp.Data.Code = "get_account_error"
+		errResp.Data.Description = "Unable to fetch account details"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if account == nil {
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	// The account is changed on condition of the version read, so that a
+	// concurrent change is not overwritten
+	if expected := ifMatch(c); expected != 0 && expected != account.Version {
+		return versionMismatchError(c, id)
+	}
+
+	if err = patch.applyTo(account); err != nil {
+		errResp.Data.Code = "invalid_account"
+		errResp.Data.Description = err.Error()
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err = c.Validate(newUserProfile(*account)); err != nil {
+		return validationError(c, err)
+	}
+
+	err = h.users.UpdateUser(account, callerOf(c).UID)
+
+	var mismatch *storage.VersionMismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		return versionMismatchError(c, id)
+	case errors.Is(err, storage.ErrUserNotFound):
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	case err != nil:
+		errResp.Data.Code = "update_account_error"
+		errResp.Data.Description = "Unable to update account"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
 
+	resp.mapFromModel(*account)
+	setETag(c, account.Version)
 	return c.JSON(http.StatusOK, resp)
 }
-func listCarBookings(c echo.Context) error {
+
+// listUserHistory is a handler function for listing the changes made to an
+// account, oldest first
+func (h *handler) listUserHistory(c echo.Context) error {
 	var errResp ErrorResponseData
-	var resp AccountListResponseData
+	var resp UserHistoryResponseData
 
 	id := strings.TrimSpace(c.Param("id"))
-	if len(id) == 0 {
-		errResp.Data.Code = "invalid_param_error"
-		errResp.Data.Description = "Value for account id not set in request"
+
+	account, err := h.users.GetAccount(id)
+	if err != nil {
+		errResp.Data.Code = "get_account_error"
+		errResp.Data.Description = "Unable to fetch account details"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if account == nil {
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	changes, err := h.users.ListUserHistory(id)
+	if err != nil {
+		errResp.Data.Code = "list_account_history_error"
+		errResp.Data.Description = "Unable to fetch account history"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(changes)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// searchCars is a handler for listing cars available for the whole of the
+// window given by query parameters fromDateTime and toDateTime
+func (h *handler) searchCars(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp CarListResponseData
+
+	from, to, err := queryTimeWindow(c)
+	if err != nil {
+		errResp.Data.Code = "invalid_parameter_error"
+		errResp.Data.Description = err.Error()
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	//change here
-	totalItems, accounts, err := storage.GetAccountList(fromDateTime, toDateTime)
+	cars, err := h.cars.SearchAvailableCars(from, to)
 
 	if err != nil {
-		errResp.Data.Code = "error"
-		errResp.Data.Description = "Unable to fetch list "
+		errResp.Data.Code = "search_cars_error"
+		errResp.Data.Description = "Unable to fetch available cars"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	for _, account := range accounts {
-		var respAccount UserResponseData
-		respAccount.mapFromModel(account)
-		resp.Data = append(resp.Data, respAccount.Data)
+	resp.Data = []CarResponse{}
+	for _, car := range cars {
+		var respCar CarResponseData
+		respCar.mapFromModel(car)
+		resp.Data = append(resp.Data, respCar.Data)
 	}
 
 	pageSize := 10
-	resp.Meta.TotalPages = (totalItems / pageSize) + 1
+	resp.Meta.TotalPages = (len(cars) / pageSize) + 1
 
 	return c.JSON(http.StatusOK, resp)
 }
 
-//BookCar hnadler function
-func bookCar(c echo.Context) error {
+// validationError responds to a request failing validation with every
+// invalid field
+func validationError(c echo.Context, err error) error {
 	var errResp ErrorResponseData
-	var resp AccountListResponseData
+	errResp.Data.Code = "validation_error"
+	errResp.Data.Description = "Request has invalid fields"
+	errResp.Data.Status = strconv.Itoa(http.StatusUnprocessableEntity)
 
-	fromDateTime, err := strconv.Atoi(c.Param("fromDateTime"))
+	var fieldErrors validation.Errors
+	if !errors.As(err, &fieldErrors) {
+		errResp.Data.Description = err.Error()
+	}
+	errResp.Data.Fields = fieldErrors
+	return c.JSON(http.StatusUnprocessableEntity, errResp)
+}
 
+// queryTimeWindow reads the fromDateTime and toDateTime query parameters,
+// given as unix timestamps
+func queryTimeWindow(c echo.Context) (time.Time, time.Time, error) {
+	fromDateTime, err := strconv.ParseInt(c.QueryParam("fromDateTime"), 10, 64)
 	if (err != nil) || (fromDateTime <= 0) {
-		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value   in query parameter fromDateTime"
-		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
-		return c.JSON(http.StatusBadRequest, errResp)
+		return time.Time{}, time.Time{}, errors.New("Invalid value in query parameter fromDateTime")
+	}
+
+	toDateTime, err := strconv.ParseInt(c.QueryParam("toDateTime"), 10, 64)
+	if (err != nil) || (toDateTime <= fromDateTime) {
+		return time.Time{}, time.Time{}, errors.New("Invalid value in query parameter toDateTime")
 	}
-	toDateTime, err := strconv.Atoi(c.Param("toDateTime"))
 
-	if (err != nil) || (toDateTime <= 0) || toDateTime < fromDateTime {
+	return time.Unix(fromDateTime, 0).UTC(), time.Unix(toDateTime, 0).UTC(), nil
+}
+
+// calculatePrice is a handler for quoting the price of renting the car given
+// by query parameter carId for the window given by fromDateTime and toDateTime
+func (h *handler) calculatePrice(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp PriceResponseData
+
+	carID := strings.TrimSpace(c.QueryParam("carId"))
+	if len(carID) == 0 {
 		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value "
+		errResp.Data.Description = "Value for query parameter carId not set in request"
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
-	user_id, err := strconv.Atoi(c.Param("userId"))
 
-	if (err != nil) || (user_id <= 0) {
+	from, to, err := queryTimeWindow(c)
+	if err != nil {
 		errResp.Data.Code = "invalid_parameter_error"
-		errResp.Data.Description = "Invalid value   in query parameter fromDateTime"
+		errResp.Data.Description = err.Error()
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	//Change here
+	quote, err := h.pricer.Quote(carID, from, to)
+
+	if err == storage.ErrCarNotFound {
+		errResp.Data.Code = "no_car_found"
+		errResp.Data.Description = "No car with id " + carID + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
 
-	totalItems, accounts, err := storage.GetAccountList(fromDateTime, toDateTime)
+	if err == storage.ErrCarUnavailable {
+		errResp.Data.Code = "car_unavailable"
+		errResp.Data.Description = "Car " + carID + " is retired"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
 
 	if err != nil {
-		errResp.Data.Code = "error"
-		errResp.Data.Description = "Unable to fetch list "
+		errResp.Data.Code = "calculate_price_error"
+		errResp.Data.Description = "Unable to calculate price"
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	for _, account := range accounts {
-		var respAccount UserResponseData
-		respAccount.mapFromModel(account)
-		resp.Data = append(resp.Data, respAccount.Data)
+	resp.mapFromQuote(*quote)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// listUserBookings is a handler for listing bookings of a user
+func (h *handler) listUserBookings(c echo.Context) error {
+	var errResp ErrorResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	if len(id) == 0 {
+		errResp.Data.Code = "invalid_param_error"
+		errResp.Data.Description = "Value for user id not set in request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	pageSize := 10
-	resp.Meta.TotalPages = (totalItems / pageSize) + 1
+	bookings, err := h.bookings.GetUserBookings(id)
 
-	return c.JSON(http.StatusOK, resp)
+	if err != nil {
+		errResp.Data.Code = "list_bookings_error"
+		errResp.Data.Description = "Unable to fetch bookings of user " + id
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	return c.JSON(http.StatusOK, bookingList(bookings))
 }
 
-// deleteAccount is a handler function for deleting an account based on id
-func deleteAccount(c echo.Context) error {
+// listCarBookings is a handler for listing bookings of a car
+func (h *handler) listCarBookings(c echo.Context) error {
 	var errResp ErrorResponseData
 
 	id := strings.TrimSpace(c.Param("id"))
 	if len(id) == 0 {
 		errResp.Data.Code = "invalid_param_error"
-		errResp.Data.Description = "Value for account id not set in request"
+		errResp.Data.Description = "Value for car id not set in request"
 		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
 		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	noRecords, err := storage.DeleteAccount(id)
+	bookings, err := h.bookings.GetCarBookings(id)
 
 	if err != nil {
-		errResp.Data.Code = "delete_account_error"
-		errResp.Data.Description = "Unable to delete account details"
+		errResp.Data.Code = "list_bookings_error"
+		errResp.Data.Description = "Unable to fetch bookings of car " + id
 		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
 		return c.JSON(http.StatusInternalServerError, errResp)
 	}
 
-	if noRecords == 0 {
-		errResp.Data.Code = "no_account_found"
-		errResp.Data.Description = "No account with id " + id + " exists"
-		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
-		return c.JSON(http.StatusNotFound, errResp)
+	return c.JSON(http.StatusOK, bookingList(bookings))
+}
+
+// bookingList maps bookings to a list response
+func bookingList(bookings []storage.CarBooking) BookingListResponseData {
+	var resp BookingListResponseData
+
+	resp.Data = []BookingResponse{}
+	for _, booking := range bookings {
+		var respBooking BookingResponseData
+		respBooking.mapFromModel(booking)
+		resp.Data = append(resp.Data, respBooking.Data)
+	}
+
+	pageSize := 10
+	resp.Meta.TotalPages = (len(bookings) / pageSize) + 1
+
+	return resp
+}
+
+// bookCar is a handler function for booking a car for a time window
+func (h *handler) bookCar(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp BookingResponseData
+
+	carID := strings.TrimSpace(c.Param("id"))
+	if len(carID) == 0 {
+		errResp.Data.Code = "invalid_param_error"
+		errResp.Data.Description = "Value for car id not set in request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	req := new(bookingRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
 	}
 
-	return c.JSON(http.StatusNoContent, nil)
+	// Callers book for themselves unless they support customers
+	caller := callerOf(c)
+	if len(req.UserID) == 0 {
+		req.UserID = caller.UserID
+	}
+	if !caller.Holds(storage.RoleSupport, storage.RoleAdmin) && req.UserID != caller.UserID {
+		return forbidden(c, "Callers may only book for their own account unless they hold one of the roles support, admin")
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	booking := req.mapToModel(carID)
+
+	// Price the booking with the same engine that serves calculatePrice so
+	// that the booked price matches the quote. The booking is made on
+	// condition the car is still at the version quoted, and quoted again when
+	// the car was changed in between
+	var err error
+	var mismatch *storage.VersionMismatchError
+	for attempt := 0; attempt < bookingQuoteAttempts; attempt++ {
+		var quote *pricing.Quote
+		quote, err = h.pricer.Quote(carID, *booking.StartDateTime, *booking.EndDateTime)
+		if err == nil {
+			quote.ApplyTo(&booking)
+			err = h.bookings.CreateBooking(&booking)
+		}
+		if !errors.As(err, &mismatch) {
+			break
+		}
+	}
+
+	if errors.As(err, &mismatch) {
+		errResp.Data.Code = "car_changed"
+		errResp.Data.Description = "Car " + carID + " is being changed; retry the booking"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	if err == storage.ErrCarUnavailable {
+		errResp.Data.Code = "car_unavailable"
+		errResp.Data.Description = "Car " + carID + " is retired or not available for booking"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	var licence *storage.LicenceError
+	if errors.As(err, &licence) {
+		return licenceError(c, licence)
+	}
+
+	var conflict *storage.BookingConflictError
+	if errors.As(err, &conflict) {
+		errResp.Data.Code = "booking_conflict"
+		errResp.Data.Description = "Car " + carID + " is already booked in the requested window"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	if err == storage.ErrCarNotFound {
+		errResp.Data.Code = "no_car_found"
+		errResp.Data.Description = "No car with id " + carID + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	if err != nil {
+		errResp.Data.Code = "create_booking_error"
+		errResp.Data.Description = "Unable to create booking"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(booking)
+	setETag(c, booking.Version)
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// getBooking is a handler function for fetching a booking based on id
+func (h *handler) getBooking(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp BookingResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	if len(id) == 0 {
+		errResp.Data.Code = "invalid_param_error"
+		errResp.Data.Description = "Value for booking id not set in request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	booking, err := h.bookings.GetBooking(id)
+
+	if err != nil {
+		errResp.Data.Code = "get_booking_error"
+		errResp.Data.Description = "Unable to fetch booking details"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if booking == nil {
+		errResp.Data.Code = "no_booking_found"
+		errResp.Data.Description = "No booking with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	resp.mapFromModel(*booking)
+	setETag(c, booking.Version)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// transitionBooking returns a handler function that moves the booking given
+// by id to status
+func (h *handler) transitionBooking(status storage.BookingStatus) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errResp ErrorResponseData
+		var resp BookingResponseData
+
+		id := strings.TrimSpace(c.Param("id"))
+		if len(id) == 0 {
+			errResp.Data.Code = "invalid_param_error"
+			errResp.Data.Description = "Value for booking id not set in request"
+			errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+			return c.JSON(http.StatusBadRequest, errResp)
+		}
+
+		booking, err := h.bookings.UpdateBookingStatus(id, ifMatch(c), status)
+		if err != nil {
+			return bookingUpdateError(c, id, err)
+		}
+
+		resp.mapFromModel(*booking)
+		setETag(c, booking.Version)
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+// cancelBooking is a handler function for cancelling a booking, refunding
+// it according to the cancellation policy
+func (h *handler) cancelBooking(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp BookingResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	if len(id) == 0 {
+		errResp.Data.Code = "invalid_param_error"
+		errResp.Data.Description = "Value for booking id not set in request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	booking, err := h.bookings.CancelBooking(id, ifMatch(c), func(booking storage.CarBooking) int {
+		return h.cancellation.Refund(booking, time.Now())
+	})
+	if err != nil {
+		return bookingUpdateError(c, id, err)
+	}
+
+	resp.mapFromModel(*booking)
+	setETag(c, booking.Version)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// changeBookingEnd returns a handler function that moves the end of the
+// booking given by id for an extension or early return, re-pricing the change
+func (h *handler) changeBookingEnd(kind storage.AdjustmentKind) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errResp ErrorResponseData
+		var resp BookingResponseData
+
+		id := strings.TrimSpace(c.Param("id"))
+		if len(id) == 0 {
+			errResp.Data.Code = "invalid_param_error"
+			errResp.Data.Description = "Value for booking id not set in request"
+			errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+			return c.JSON(http.StatusBadRequest, errResp)
+		}
+
+		req := new(bookingEndRequest)
+		if err := c.Bind(req); err != nil {
+			errResp.Data.Code = "request_binding_error"
+			errResp.Data.Description = "Unable to bind request"
+			errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+			return c.JSON(http.StatusBadRequest, errResp)
+		}
+
+		if err := c.Validate(req); err != nil {
+			return validationError(c, err)
+		}
+
+		end := time.Unix(req.EndDateTime, 0).UTC()
+		_, err := h.bookings.ChangeBookingEnd(id, ifMatch(c), kind, end, func(booking storage.CarBooking, car storage.Car) int {
+			return h.pricer.Adjustment(booking, car, end)
+		})
+		if err != nil {
+			return bookingUpdateError(c, id, err)
+		}
+
+		// Read the booking back so that the response carries all its adjustment lines
+		booking, err := h.bookings.GetBooking(id)
+		if err != nil || booking == nil {
+			errResp.Data.Code = "get_booking_error"
+			errResp.Data.Description = "Unable to fetch booking details"
+			errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+			return c.JSON(http.StatusInternalServerError, errResp)
+		}
+
+		resp.mapFromModel(*booking)
+		setETag(c, booking.Version)
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+// setETag tags the response with the version of the car or booking it holds
+func setETag(c echo.Context, version int) {
+	c.Response().Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// ifMatch returns the version the request requires of the resource changed
+// through its If-Match header, or 0 when any version may be changed. An
+// If-Match header that is not a single ETag of this API returns -1, which
+// matches no version
+func ifMatch(c echo.Context) int {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if len(header) == 0 || header == "*" {
+		return 0
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version <= 0 {
+		return -1
+	}
+	return version
+}
+
+// versionMismatchError writes the error response for a change to the car or
+// booking given by id on condition of a version it is no longer at
+func versionMismatchError(c echo.Context, id string) error {
+	var errResp ErrorResponseData
+	errResp.Data.Code = "version_mismatch"
+	errResp.Data.Description = id + " was changed since it was read; fetch it again and retry"
+	errResp.Data.Status = strconv.Itoa(http.StatusPreconditionFailed)
+	return c.JSON(http.StatusPreconditionFailed, errResp)
+}
+
+// licenceError writes the error response for a booking the user's driving
+// licence does not allow
+func licenceError(c echo.Context, licence *storage.LicenceError) error {
+	var errResp ErrorResponseData
+	switch licence.Status {
+	case storage.LicenceMissing:
+		errResp.Data.Code = "licence_missing"
+	case storage.LicenceVerified:
+		errResp.Data.Code = "licence_expired"
+	default:
+		errResp.Data.Code = "licence_not_verified"
+	}
+	errResp.Data.Description = licence.Error()
+	errResp.Data.Status = strconv.Itoa(http.StatusUnprocessableEntity)
+	return c.JSON(http.StatusUnprocessableEntity, errResp)
+}
+
+// bookingUpdateError writes the error response for a failed update of the
+// booking given by id
+func bookingUpdateError(c echo.Context, id string, err error) error {
+	var errResp ErrorResponseData
+
+	var mismatch *storage.VersionMismatchError
+	if errors.As(err, &mismatch) {
+		return versionMismatchError(c, id)
+	}
+
+	var transition *storage.InvalidTransitionError
+	if errors.As(err, &transition) {
+		errResp.Data.Code = "invalid_status_transition"
+		errResp.Data.Description = "Booking " + id + " cannot move from " + string(transition.From) + " to " + string(transition.To)
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	var licence *storage.LicenceError
+	if errors.As(err, &licence) {
+		return licenceError(c, licence)
+	}
+
+	var conflict *storage.BookingConflictError
+	if errors.As(err, &conflict) {
+		errResp.Data.Code = "booking_conflict"
+		errResp.Data.Description = "Car " + conflict.CarID + " is already booked in the requested window"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	if err == storage.ErrBookingClosed {
+		errResp.Data.Code = "booking_closed"
+		errResp.Data.Description = "Booking " + id + " can no longer be changed"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	if err == storage.ErrInvalidAdjustment {
+		errResp.Data.Code = "invalid_parameter_error"
+		errResp.Data.Description = "Invalid value for end_date_time"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err == storage.ErrBookingNotFound {
+		errResp.Data.Code = "no_booking_found"
+		errResp.Data.Description = "No booking with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	errResp.Data.Code = "update_booking_error"
+	errResp.Data.Description = "Unable to update booking"
+	errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+	return c.JSON(http.StatusInternalServerError, errResp)
+}
+
+// requestOTP is a handler function for sending a one-time code to sign in
+// with to a mobile number
+func (h *handler) requestOTP(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp OTPResponseData
+
+	req := new(otpRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	expiresAt, err := h.otp.Request(c.Request().Context(), req.Mobile)
+
+	if errors.Is(err, storage.ErrOTPRateLimited) {
+		errResp.Data.Code = "too_many_requests"
+		errResp.Data.Description = "Too many codes were sent to " + req.Mobile + ", try again later"
+		errResp.Data.Status = strconv.Itoa(http.StatusTooManyRequests)
+		return c.JSON(http.StatusTooManyRequests, errResp)
+	}
+
+	if err != nil {
+		errResp.Data.Code = "send_otp_error"
+		errResp.Data.Description = "Unable to send one-time code"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.Data.Mobile = req.Mobile
+	resp.Data.ExpiresAt = expiresAt
+	return c.JSON(http.StatusAccepted, resp)
+}
+
+// verifyOTP is a handler function for signing in with the one-time code last
+// sent to a mobile number, returning a session token
+func (h *handler) verifyOTP(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp SessionResponseData
+
+	req := new(otpVerifyRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	session, err := h.otp.Verify(c.Request().Context(), req.Mobile, strings.TrimSpace(req.Code))
+
+	switch {
+	case errors.Is(err, otp.ErrInvalidCode):
+		errResp.Data.Code = "invalid_code"
+		errResp.Data.Description = "Code is invalid or expired"
+		errResp.Data.Status = strconv.Itoa(http.StatusUnauthorized)
+		return c.JSON(http.StatusUnauthorized, errResp)
+	case errors.Is(err, otp.ErrTooManyAttempts):
+		errResp.Data.Code = "too_many_attempts"
+		errResp.Data.Description = "Too many codes were tried, request a new code"
+		errResp.Data.Status = strconv.Itoa(http.StatusTooManyRequests)
+		return c.JSON(http.StatusTooManyRequests, errResp)
+	case err != nil:
+		errResp.Data.Code = "verify_otp_error"
+		errResp.Data.Description = "Unable to verify one-time code"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.Data.Token = session.Token
+	resp.Data.TokenType = "Bearer"
+	resp.Data.ExpiresAt = session.ExpiresAt
+	resp.Data.UID = session.UID
+	resp.Data.UserID = session.UserID
+	return c.JSON(http.StatusOK, resp)
+}
+
+// setUserRole is a handler function for assigning a role to a user
+func (h *handler) setUserRole(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp UserResponseData
+
+	req := new(roleRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	id := strings.TrimSpace(c.Param("id"))
+	user, err := h.users.SetUserRole(id, storage.Role(req.Role), callerOf(c).UID)
+
+	if errors.Is(err, storage.ErrUserNotFound) {
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	if err != nil {
+		errResp.Data.Code = "set_role_error"
+		errResp.Data.Description = "Unable to set role of account"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(*user)
+	setETag(c, user.Version)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// submitLicence is a handler function for submitting the driving licence of
+// an account for review, replacing any licence submitted before
+func (h *handler) submitLicence(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp LicenceResponseData
+
+	req := new(licenceRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	id := strings.TrimSpace(c.Param("id"))
+	licence := req.mapToModel(id)
+	err := h.licences.SubmitLicence(&licence, callerOf(c).UID)
+
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	case errors.Is(err, storage.ErrLicenceRegistered):
+		errResp.Data.Code = "licence_registered"
+		errResp.Data.Description = "Driving licence " + licence.Number + " is registered to another account"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	case err != nil:
+		errResp.Data.Code = "submit_licence_error"
+		errResp.Data.Description = "Unable to submit driving licence"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(licence)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// getLicence is a handler function for fetching the driving licence of an
+// account and the outcome of its review
+func (h *handler) getLicence(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp LicenceResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	licence, err := h.licences.GetLicence(id)
+
+	if err != nil {
+		errResp.Data.Code = "get_licence_error"
+		errResp.Data.Description = "Unable to fetch driving licence"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if licence == nil {
+		errResp.Data.Code = "no_licence_found"
+		errResp.Data.Description = "No driving licence was submitted for account " + id
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	resp.mapFromModel(*licence)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// reviewLicence is a handler function for verifying or rejecting the driving
+// licence of an account
+func (h *handler) reviewLicence(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp LicenceResponseData
+
+	req := new(licenceReviewRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	status := storage.LicenceStatus(req.Status)
+	reason := strings.TrimSpace(req.Reason)
+	if status == storage.LicenceRejected && len(reason) == 0 {
+		return validationError(c, validation.Errors{{Field: "reason", Rule: "required", Message: "is required to reject a licence"}})
+	}
+	if status == storage.LicenceVerified {
+		reason = ""
+	}
+
+	id := strings.TrimSpace(c.Param("id"))
+	licence, err := h.licences.ReviewLicence(id, status, reason, callerOf(c).UID)
+
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	case errors.Is(err, storage.ErrLicenceNotFound):
+		errResp.Data.Code = "no_licence_found"
+		errResp.Data.Description = "No driving licence was submitted for account " + id
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	case err != nil:
+		errResp.Data.Code = "review_licence_error"
+		errResp.Data.Description = "Unable to review driving licence"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(*licence)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// deleteAccount is a handler function for deleting an account based on id
+func (h *handler) deleteAccount(c echo.Context) error {
+	var errResp ErrorResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	if len(id) == 0 {
+		errResp.Data.Code = "invalid_param_error"
+		errResp.Data.Description = "Value for account id not set in request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	noRecords, err := h.users.DeleteAccount(id)
+
+	if err != nil {
+		errResp.Data.Code = "delete_account_error"
+		errResp.Data.Description = "Unable to delete account details"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if noRecords == 0 {
+		errResp.Data.Code = "no_account_found"
+		errResp.Data.Description = "No account with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// createWebhook is a handler function for subscribing a partner webhook to
+// events. The response carries the secret deliveries are signed with
+func (h *handler) createWebhook(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp WebhookResponseData
+
+	req := new(webhookRequest)
+	if err := c.Bind(req); err != nil {
+		errResp.Data.Code = "request_binding_error"
+		errResp.Data.Description = "Unable to bind request"
+		errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+		return c.JSON(http.StatusBadRequest, errResp)
+	}
+
+	if err := c.Validate(req); err != nil {
+		return validationError(c, err)
+	}
+
+	subscription, err := req.mapToModel()
+	if err == nil {
+		err = h.webhooks.CreateSubscription(&subscription)
+	}
+
+	if err != nil {
+		errResp.Data.Code = "create_webhook_error"
+		errResp.Data.Description = "Unable to create webhook subscription"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(subscription)
+	resp.Data.Secret = subscription.Secret
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// listWebhooks is a handler function for listing webhook subscriptions
+func (h *handler) listWebhooks(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp WebhookListResponseData
+
+	subscriptions, err := h.webhooks.ListSubscriptions()
+
+	if err != nil {
+		errResp.Data.Code = "list_webhooks_error"
+		errResp.Data.Description = "Unable to fetch webhook subscriptions"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.Data = []WebhookResponse{}
+	for _, subscription := range subscriptions {
+		var respWebhook WebhookResponseData
+		respWebhook.mapFromModel(subscription)
+		resp.Data = append(resp.Data, respWebhook.Data)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// getWebhook is a handler function for fetching a webhook subscription based
+// on id
+func (h *handler) getWebhook(c echo.Context) error {
+	var resp WebhookResponseData
+
+	subscription, err := h.subscription(c)
+	if subscription == nil {
+		return err
+	}
+
+	resp.mapFromModel(*subscription)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// deleteWebhook is a handler function for unsubscribing a webhook. Its
+// pending deliveries are no longer attempted
+func (h *handler) deleteWebhook(c echo.Context) error {
+	var errResp ErrorResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	err := h.webhooks.DeleteSubscription(id)
+
+	if errors.Is(err, storage.ErrSubscriptionNotFound) {
+		errResp.Data.Code = "no_webhook_found"
+		errResp.Data.Description = "No webhook subscription with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	if err != nil {
+		errResp.Data.Code = "delete_webhook_error"
+		errResp.Data.Description = "Unable to delete webhook subscription"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// listWebhookDeliveries is a handler function for the delivery log of a
+// webhook subscription, newest first, with query limit (default 50, at most
+// 500)
+func (h *handler) listWebhookDeliveries(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp DeliveryListResponseData
+
+	limit := 50
+	if len(c.QueryParam("limit")) > 0 {
+		var err error
+		limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit <= 0 || limit > 500 {
+			errResp.Data.Code = "invalid_param_error"
+			errResp.Data.Description = "Value for limit must be between 1 and 500"
+			errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+			return c.JSON(http.StatusBadRequest, errResp)
+		}
+	}
+
+	subscription, err := h.subscription(c)
+	if subscription == nil {
+		return err
+	}
+
+	deliveries, err := h.webhooks.ListDeliveries(subscription.ID, limit)
+
+	if err != nil {
+		errResp.Data.Code = "list_deliveries_error"
+		errResp.Data.Description = "Unable to fetch webhook deliveries"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.Data = []DeliveryResponse{}
+	for _, delivery := range deliveries {
+		var respDelivery DeliveryResponseData
+		respDelivery.mapFromModel(delivery)
+		resp.Data = append(resp.Data, respDelivery.Data)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// replayWebhookDelivery is a handler function for delivering an event to a
+// webhook again, whatever the outcome of earlier attempts
+func (h *handler) replayWebhookDelivery(c echo.Context) error {
+	var errResp ErrorResponseData
+	var resp DeliveryResponseData
+
+	subscription, err := h.subscription(c)
+	if subscription == nil {
+		return err
+	}
+
+	id := strings.TrimSpace(c.Param("deliveryId"))
+	delivery, err := h.webhooks.ReplayDelivery(subscription.ID, id)
+
+	if errors.Is(err, storage.ErrDeliveryNotFound) {
+		errResp.Data.Code = "no_delivery_found"
+		errResp.Data.Description = "No delivery with id " + id + " exists for webhook subscription " + subscription.ID
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return c.JSON(http.StatusNotFound, errResp)
+	}
+
+	if err != nil {
+		errResp.Data.Code = "replay_delivery_error"
+		errResp.Data.Description = "Unable to replay webhook delivery"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	resp.mapFromModel(*delivery)
+	return c.JSON(http.StatusAccepted, resp)
+}
+
+// subscription fetches the webhook subscription of the id path parameter.
+// When there is none it writes the error response and returns nil
+func (h *handler) subscription(c echo.Context) (*storage.WebhookSubscription, error) {
+	var errResp ErrorResponseData
+
+	id := strings.TrimSpace(c.Param("id"))
+	subscription, err := h.webhooks.GetSubscription(id)
+
+	if err != nil {
+		errResp.Data.Code = "get_webhook_error"
+		errResp.Data.Description = "Unable to fetch webhook subscription"
+		errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+		return nil, c.JSON(http.StatusInternalServerError, errResp)
+	}
+
+	if subscription == nil {
+		errResp.Data.Code = "no_webhook_found"
+		errResp.Data.Description = "No webhook subscription with id " + id + " exists"
+		errResp.Data.Status = strconv.Itoa(http.StatusNotFound)
+		return nil, c.JSON(http.StatusNotFound, errResp)
+	}
+	return subscription, nil
 }
@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"../logger"
+	"../storage"
+	"github.com/labstack/echo/v4"
+)
+
+// headerIdempotencyKey names the header clients set to make retries of a
+// request safe
+const headerIdempotencyKey = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// idempotent returns middleware that handles a request carrying an
+// Idempotency-Key header at most once within ttl. The first response to the
+// request is stored and replayed for retries with the same key, while reusing
+// the key for a different request is rejected. Server errors are not stored,
+// so that such requests can be retried. The key is held for lease while the
+// request is handled, so that a request that never completes does not block
+// its retries for the whole ttl
+func idempotent(store storage.IdempotencyRepository, ttl time.Duration, lease time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var errResp ErrorResponseData
+
+			key := c.Request().Header.Get(headerIdempotencyKey)
+			if len(key) == 0 {
+				return next(c)
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				errResp.Data.Code = "invalid_idempotency_key"
+				errResp.Data.Description = "Idempotency-Key must be at most " + strconv.Itoa(maxIdempotencyKeyLength) + " characters"
+				errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+				return c.JSON(http.StatusBadRequest, errResp)
+			}
+
+			body, err := ioutil.ReadAll(c.Request().Body)
+			if err != nil {
+				errResp.Data.Code = "request_binding_error"
+				errResp.Data.Description = "Unable to read request"
+				errResp.Data.Status = strconv.Itoa(http.StatusBadRequest)
+				return c.JSON(http.StatusBadRequest, errResp)
+			}
+			c.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			// Keys are scoped to the caller, so that callers choosing the same
+			// key never see each other's responses
+			if caller := callerOf(c); len(caller.UID) > 0 {
+				scoped := sha256.Sum256([]byte(caller.UID + "\n" + key))
+				key = hex.EncodeToString(scoped[:])
+			}
+
+			created := time.Now().UTC()
+			expiresAt := created.Add(lease)
+			record := storage.IdempotencyRecord{
+				Key:         key,
+				RequestHash: requestHash(c, body),
+				Created:     &created,
+				ExpiresAt:   &expiresAt,
+			}
+
+			existing, err := store.ClaimIdempotencyKey(&record)
+			if err != nil {
+				errResp.Data.Code = "idempotency_key_error"
+				errResp.Data.Description = "Unable to check idempotency key"
+				errResp.Data.Status = strconv.Itoa(http.StatusInternalServerError)
+				return c.JSON(http.StatusInternalServerError, errResp)
+			}
+
+			if existing != nil {
+				return replay(c, *existing, record.RequestHash)
+			}
+
+			// Record the response while writing it to the client
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			err = next(c)
+
+			slog := logger.InitSugarLogger()
+			defer slog.Sync() // Flushes buffer, if any
+
+			status := c.Response().Status
+			if err != nil || status >= http.StatusInternalServerError {
+				if releaseErr := store.ReleaseIdempotencyKey(key); releaseErr != nil {
+					slog.Errorw("Unable to release idempotency key after failed request",
+						"error", releaseErr)
+				}
+				return err
+			}
+
+			contentType := c.Response().Header().Get(echo.HeaderContentType)
+			if saveErr := store.SaveIdempotentResponse(key, status, contentType, recorder.body.Bytes(), created.Add(ttl)); saveErr != nil {
+				slog.Errorw("Unable to save response for idempotency key",
+					"error", saveErr)
+			}
+			return nil
+		}
+	}
+}
+
+// replay responds to a retry with the stored response of the request that
+// first used its idempotency key
+func replay(c echo.Context, record storage.IdempotencyRecord, hash string) error {
+	var errResp ErrorResponseData
+
+	if record.RequestHash != hash {
+		errResp.Data.Code = "idempotency_key_reused"
+		errResp.Data.Description = "Idempotency-Key was already used for a different request"
+		errResp.Data.Status = strconv.Itoa(http.StatusUnprocessableEntity)
+		return c.JSON(http.StatusUnprocessableEntity, errResp)
+	}
+
+	if record.StatusCode == 0 {
+		errResp.Data.Code = "request_in_progress"
+		errResp.Data.Description = "A request with this Idempotency-Key is still being handled"
+		errResp.Data.Status = strconv.Itoa(http.StatusConflict)
+		return c.JSON(http.StatusConflict, errResp)
+	}
+
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+	return c.Blob(record.StatusCode, record.ContentType, record.Body)
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(c echo.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request().Method + " " + c.Request().URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder copies the body written to a response
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(b []byte) (int, error) {
+	recorder.body.Write(b)
+	return recorder.ResponseWriter.Write(b)
+}
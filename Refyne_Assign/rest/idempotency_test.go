@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"../storage"
+	"github.com/labstack/echo/v4"
+)
+
+// idempotentServer serves POST /things through the idempotency middleware,
+// calling handle for every request that reaches the handler
+func idempotentServer(store storage.IdempotencyRepository, handle func(c echo.Context) error) *echo.Echo {
+	e := echo.New()
+	e.POST("/things", handle, idempotent(store, time.Hour, time.Minute))
+	return e
+}
+
+// post sends body to /things with the idempotency key, if any
+func post(e *echo.Echo, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if len(key) > 0 {
+		req.Header.Set(headerIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotentReplaysResponse(t *testing.T) {
+	calls := 0
+	e := idempotentServer(storage.NewMemoryStore(), func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, map[string]int{"call": calls})
+	})
+
+	first := post(e, "key-1", `{"name":"Asha"}`)
+	retry := post(e, "key-1", `{"name":"Asha"}`)
+
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want once", calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry got %d %s, want %d %s", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+	if retry.Header().Get(echo.HeaderContentType) != first.Header().Get(echo.HeaderContentType) || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry got headers %v", retry.Header())
+	}
+}
+
+func TestIdempotentRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		// retry sends the retry of a request with key key-1 and body
+		// {"name":"Asha"}, from inside the handler of the request when
+		// inFlight is set
+		retry    func(e *echo.Echo) *httptest.ResponseRecorder
+		inFlight bool
+		want     int
+		code     string
+	}{
+		{"key reused for another body", func(e *echo.Echo) *httptest.ResponseRecorder {
+			return post(e, "key-1", `{"name":"Ravi"}`)
+		}, false, http.StatusUnprocessableEntity, "idempotency_key_reused"},
+		{"retry while in progress", func(e *echo.Echo) *httptest.ResponseRecorder {
+			return post(e, "key-1", `{"name":"Asha"}`)
+		}, true, http.StatusConflict, "request_in_progress"},
+		{"key too long", func(e *echo.Echo) *httptest.ResponseRecorder {
+			return post(e, strings.Repeat("k", maxIdempotencyKeyLength+1), `{"name":"Asha"}`)
+		}, false, http.StatusBadRequest, "invalid_idempotency_key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var e *echo.Echo
+			var retry *httptest.ResponseRecorder
+			e = idempotentServer(storage.NewMemoryStore(), func(c echo.Context) error {
+				if test.inFlight && retry == nil {
+					retry = test.retry(e)
+				}
+				return c.NoContent(http.StatusCreated)
+			})
+
+			if rec := post(e, "key-1", `{"name":"Asha"}`); rec.Code != http.StatusCreated {
+				t.Fatalf("first request got %d, want %d", rec.Code, http.StatusCreated)
+			}
+			if !test.inFlight {
+				retry = test.retry(e)
+			}
+
+			if retry.Code != test.want || !strings.Contains(retry.Body.String(), `"code":"`+test.code+`"`) {
+				t.Errorf("got %d %s, want %d %s", retry.Code, retry.Body.String(), test.want, test.code)
+			}
+		})
+	}
+}
+
+func TestIdempotentRetriesServerErrors(t *testing.T) {
+	calls := 0
+	e := idempotentServer(storage.NewMemoryStore(), func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			return c.NoContent(http.StatusServiceUnavailable)
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+
+	post(e, "key-1", `{}`)
+	if rec := post(e, "key-1", `{}`); rec.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry after a server error got %d after %d calls, want %d after 2", rec.Code, calls, http.StatusCreated)
+	}
+}
+
+func TestIdempotentLease(t *testing.T) {
+	store := storage.NewMemoryStore()
+	calls := 0
+	e := echo.New()
+	e.POST("/things", func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	}, idempotent(store, time.Hour, time.Millisecond))
+
+	// A request that claimed its key and never completed holds it only for
+	// the lease
+	created := time.Now().UTC()
+	leaseEnd := created.Add(time.Millisecond)
+	if _, err := store.ClaimIdempotencyKey(&storage.IdempotencyRecord{Key: "key-1", RequestHash: "abandoned", Created: &created, ExpiresAt: &leaseEnd}); err != nil {
+		t.Fatalf("ClaimIdempotencyKey: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if rec := post(e, "key-1", `{}`); rec.Code != http.StatusCreated || calls != 1 {
+		t.Fatalf("retry after the lease got %d after %d calls, want %d after 1", rec.Code, calls, http.StatusCreated)
+	}
+
+	// The response of a completed request is replayed for the whole ttl
+	time.Sleep(5 * time.Millisecond)
+	if rec := post(e, "key-1", `{}`); rec.Code != http.StatusCreated || calls != 1 || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry after completion got %d after %d calls, want the replayed response", rec.Code, calls)
+	}
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	calls := 0
+	e := idempotentServer(storage.NewMemoryStore(), func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	})
+
+	post(e, "", `{}`)
+	post(e, "", `{}`)
+	if calls != 2 {
+		t.Errorf("handler called %d times for requests without a key, want 2", calls)
+	}
+}
@@ -1,53 +1,265 @@
 package rest
 
-import "../storage"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"../storage"
+	"github.com/google/uuid"
+)
 
 // accountRequest represents request for creating account
 type userRequest struct {
-	UserID string `json:"user_id"`
-	Mobile string `json:"mobile_no"`
+	Mobile string `json:"mobile_no" validate:"required,e164"`
+	Name   string `json:"name" validate:"maxlen=100"`
+	Email  string `json:"email" validate:"email,maxlen=254"`
+}
+
+// userPatch represents a JSON merge patch (RFC 7386) of a user. Members absent
+// from the patch are left unchanged
+type userPatch map[string]json.RawMessage
+
+// userProfile represents the fields of a user that may be changed, checked
+// once a patch is applied
+type userProfile struct {
+	Mobile string `json:"mobile_no" validate:"required,e164"`
+	Name   string `json:"name" validate:"maxlen=100"`
+	Email  string `json:"email" validate:"email,maxlen=254"`
+}
+
+// otpRequest represents request for sending a one-time code to sign in with
+type otpRequest struct {
+	Mobile string `json:"mobile_no" validate:"required,e164"`
+}
+
+// otpVerifyRequest represents request for signing in with a one-time code
+type otpVerifyRequest struct {
+	Mobile string `json:"mobile_no" validate:"required,e164"`
+	Code   string `json:"code" validate:"required"`
+}
+
+// licenceRequest represents request for submitting a driving licence, with
+// dates given as YYYY-MM-DD
+type licenceRequest struct {
+	Number       string `json:"number" validate:"required,maxlen=20"`
+	IssuingState string `json:"issuingState" validate:"required,maxlen=50"`
+	ExpiresOn    string `json:"expiresOn" validate:"required,date,future"`
+	DateOfBirth  string `json:"dateOfBirth" validate:"required,date,past"`
 }
+
+// licenceReviewRequest represents request for recording the outcome of
+// reviewing a driving licence. A reason is required to reject it
+type licenceReviewRequest struct {
+	Status string `json:"status" validate:"required,oneof=verified rejected"`
+	Reason string `json:"reason" validate:"maxlen=255"`
+}
+
+// roleRequest represents request for assigning a role to a user
+type roleRequest struct {
+	Role string `json:"role" validate:"required,oneof=customer fleet_manager support admin"`
+}
+
+// carRequest represents request for adding a car
 type carRequest struct {
-	ID               string
-	carLicenseNumber string
-	manufacturer     string
-	model            string
-	basePrice        int
-	PPH              int
-	securitydeposit  int
-	available        bool
+	CarLicenseNumber string `json:"carLicenseNumber" validate:"required,plate"`
+	Manufacturer     string `json:"manufacturer" validate:"required"`
+	Model            string `json:"model" validate:"required"`
+	BasePrice        int    `json:"basePrice" validate:"positive"`
+	PPH              int    `json:"PPH" validate:"positive"`
+	Securitydeposit  int    `json:"securitydeposit" validate:"nonnegative"`
+}
+
+// carPatch represents a JSON merge patch (RFC 7386) of a car. Members absent
+// from the patch are left unchanged
+type carPatch map[string]json.RawMessage
+
+// bookingRequest represents request for booking a car, with the window given
+// as unix timestamps. The user defaults to the caller
+type bookingRequest struct {
+	UserID       string `json:"user_id" validate:"required"`
+	FromDateTime int64  `json:"from_date_time" validate:"required,positive,before=ToDateTime"`
+	ToDateTime   int64  `json:"to_date_time" validate:"required"`
+}
+
+// bookingEndRequest represents request for changing the end of a booking,
+// given as unix timestamp
+type bookingEndRequest struct {
+	EndDateTime int64 `json:"end_date_time" validate:"required,positive"`
+}
+
+// webhookRequest represents request for subscribing a partner webhook to
+// events, optionally of given cars only. A secret is generated if not given
+type webhookRequest struct {
+	URL        string   `json:"url" validate:"required,publicurl"`
+	EventTypes []string `json:"eventTypes" validate:"required,oneof=booking.created booking.cancelled booking.completed car.updated"`
+	CarIDs     []string `json:"carIds"`
+	Secret     string   `json:"secret" validate:"minlen=16"`
+}
+
+// mapToModel maps request to dao model
+func (request webhookRequest) mapToModel() (storage.WebhookSubscription, error) {
+	created := time.Now().UTC()
+	subscription := storage.WebhookSubscription{
+		ID:      uuid.New().String(),
+		URL:     strings.TrimSpace(request.URL),
+		Secret:  request.Secret,
+		Active:  true,
+		Created: &created,
+	}
+	for _, eventType := range request.EventTypes {
+		subscription.EventTypes = append(subscription.EventTypes, storage.EventType(eventType))
+	}
+	for _, id := range request.CarIDs {
+		if id = strings.TrimSpace(id); len(id) > 0 {
+			subscription.CarIDs = append(subscription.CarIDs, id)
+		}
+	}
+
+	if len(subscription.Secret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return subscription, err
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+	return subscription, nil
 }
 
 // mapToModel maps request to dao model
 func (request userRequest) mapToModel() storage.User {
 	var user storage.User
-	user.ID = request.UserID
 	user.Mobile = request.Mobile
+	user.Name = strings.TrimSpace(request.Name)
+	user.Email = strings.TrimSpace(request.Email)
 	return user
 }
+
+// mapToModel maps request for the licence of given user to dao model. The
+// number is compared without case, spaces or hyphens
+func (request licenceRequest) mapToModel(userID string) storage.Licence {
+	expiresOn, _ := time.Parse(storage.DateLayout, request.ExpiresOn)
+	dateOfBirth, _ := time.Parse(storage.DateLayout, request.DateOfBirth)
+	return storage.Licence{
+		UserID:       userID,
+		Number:       strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(request.Number)),
+		IssuingState: strings.TrimSpace(request.IssuingState),
+		ExpiresOn:    &expiresOn,
+		DateOfBirth:  &dateOfBirth,
+	}
+}
+
+// newUserProfile returns the profile of user to validate
+func newUserProfile(user storage.User) userProfile {
+	return userProfile{
+		Mobile: user.Mobile,
+		Name:   user.Name,
+		Email:  user.Email,
+	}
+}
+
+// applyTo merges patch into user. The name and email may be removed with
+// null, the mobile number may not
+func (patch userPatch) applyTo(user *storage.User) error {
+	for member, value := range patch {
+		var err error
+		switch member {
+		case "mobile_no":
+			if string(value) == "null" {
+				return fmt.Errorf("%s cannot be removed", member)
+			}
+			err = json.Unmarshal(value, &user.Mobile)
+		case "name":
+			user.Name = ""
+			err = json.Unmarshal(value, &user.Name)
+			user.Name = strings.TrimSpace(user.Name)
+		case "email":
+			user.Email = ""
+			err = json.Unmarshal(value, &user.Email)
+			user.Email = strings.TrimSpace(user.Email)
+		default:
+			return fmt.Errorf("%s cannot be changed", member)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %s", member)
+		}
+	}
+	return nil
+}
+
+// DAO maps request to dao model
 func (request carRequest) DAO() storage.Car {
 	var car storage.Car
-	car.ID = request.ID
-	car.CarLicenseNumber = request.carLicenseNumber
-	car.Manufacturer = request.manufacturer
-	car.Model = request.model
-	car.BasePrice = request.basePrice
+	car.CarLicenseNumber = strings.TrimSpace(request.CarLicenseNumber)
+	car.Manufacturer = strings.TrimSpace(request.Manufacturer)
+	car.Model = strings.TrimSpace(request.Model)
+	car.BasePrice = request.BasePrice
 	car.PPH = request.PPH
-	car.Securitydeposit = request.securitydeposit
-	car.Available = request.available
+	car.Securitydeposit = request.Securitydeposit
 	return car
+}
 
+// newCarRequest maps dao model to request, so that a changed car can be
+// validated like a new one
+func newCarRequest(car storage.Car) carRequest {
+	return carRequest{
+		CarLicenseNumber: car.CarLicenseNumber,
+		Manufacturer:     car.Manufacturer,
+		Model:            car.Model,
+		BasePrice:        car.BasePrice,
+		PPH:              car.PPH,
+		Securitydeposit:  car.Securitydeposit,
+	}
+}
+
+// applyTo merges patch into car. As every car field is required, none may
+// be removed with null
+func (patch carPatch) applyTo(car *storage.Car) error {
+	for member, value := range patch {
+		if string(value) == "null" {
+			return fmt.Errorf("%s cannot be removed", member)
+		}
+
+		var err error
+		switch member {
+		case "carLicenseNumber":
+			err = json.Unmarshal(value, &car.CarLicenseNumber)
+			car.CarLicenseNumber = strings.TrimSpace(car.CarLicenseNumber)
+		case "manufacturer":
+			err = json.Unmarshal(value, &car.Manufacturer)
+			car.Manufacturer = strings.TrimSpace(car.Manufacturer)
+		case "model":
+			err = json.Unmarshal(value, &car.Model)
+			car.Model = strings.TrimSpace(car.Model)
+		case "basePrice":
+			err = json.Unmarshal(value, &car.BasePrice)
+		case "PPH":
+			err = json.Unmarshal(value, &car.PPH)
+		case "securitydeposit":
+			err = json.Unmarshal(value, &car.Securitydeposit)
+		case "available":
+			err = json.Unmarshal(value, &car.Available)
+		default:
+			return fmt.Errorf("%s cannot be changed", member)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %s", member)
+		}
+	}
+	return nil
 }
-func (request carRequest) DAOcarBooking() storage.carBooking {
-	var car storage.carBooking
-	car.BookingId = request.ID
-	car.CarLicenseNumber = request.carLicenseNumber
-	car.Manufacturer = request.manufacturer
-	car.Model = request.model
-	car.BasePrice = request.basePrice
-	car.PPH = request.PPH
-	car.Securitydeposit = request.securitydeposit
-	car.Available = request.available
-	return car
 
+// mapToModel maps booking request for the given car to dao model
+func (request bookingRequest) mapToModel(carID string) storage.CarBooking {
+	var booking storage.CarBooking
+	start := time.Unix(request.FromDateTime, 0).UTC()
+	end := time.Unix(request.ToDateTime, 0).UTC()
+	booking.CarID = carID
+	booking.UserID = request.UserID
+	booking.StartDateTime = &start
+	booking.EndDateTime = &end
+	return booking
 }
@@ -1,7 +1,13 @@
 package rest
 
 import (
+	"encoding/json"
+	"time"
+
+	"../carimport"
+	"../pricing"
 	"../storage"
+	"../validation"
 )
 
 // AccountListResponseData represents account list response data
@@ -32,9 +38,235 @@ type UserResponseData struct {
 
 // AccountResponse represents response for account
 type UserResponse struct {
-	ID     string `json:"id"`
-	mobile string `json:"mobile"`
-	Status string `json:"status"`
+	ID            string     `json:"id"`
+	Mobile        string     `json:"mobile"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	LicenceStatus string     `json:"licenceStatus"`
+	Status        string     `json:"status"`
+	Created       *time.Time `json:"created"`
+	Modified      *time.Time `json:"modified"`
+	Version       int        `json:"version"`
+}
+
+// UserHistoryResponseData represents user change history response data
+type UserHistoryResponseData struct {
+	Data []UserChangeResponse `json:"data"`
+}
+
+// UserChangeResponse represents response for a change to one field of a user.
+// ChangedBy is omitted for changes made by an operator
+type UserChangeResponse struct {
+	ID        string     `json:"id"`
+	Field     string     `json:"field"`
+	OldValue  string     `json:"oldValue"`
+	NewValue  string     `json:"newValue"`
+	ChangedBy string     `json:"changedBy,omitempty"`
+	Version   int        `json:"version"`
+	Created   *time.Time `json:"created"`
+}
+
+// LicenceResponseData represents driving licence response data
+type LicenceResponseData struct {
+	Data LicenceResponse `json:"data"`
+}
+
+// LicenceResponse represents response for a driving licence, with dates given
+// as YYYY-MM-DD
+type LicenceResponse struct {
+	UserID          string     `json:"userId"`
+	Number          string     `json:"number"`
+	IssuingState    string     `json:"issuingState"`
+	ExpiresOn       string     `json:"expiresOn"`
+	DateOfBirth     string     `json:"dateOfBirth"`
+	Status          string     `json:"status"`
+	RejectionReason string     `json:"rejectionReason,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewedAt,omitempty"`
+	Submitted       *time.Time `json:"submitted"`
+}
+
+// OTPResponseData represents one-time code response data
+type OTPResponseData struct {
+	Data OTPResponse `json:"data"`
+}
+
+// OTPResponse represents response for a one-time code sent
+type OTPResponse struct {
+	Mobile    string    `json:"mobile"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SessionResponseData represents session response data
+type SessionResponseData struct {
+	Data SessionResponse `json:"data"`
+}
+
+// SessionResponse represents response for signing in. UserID is empty until
+// the caller registers with POST /v1/user
+type SessionResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	UID       string    `json:"uid"`
+	UserID    string    `json:"userId,omitempty"`
+}
+
+// CarListResponseData represents car list response data
+type CarListResponseData struct {
+	Meta  Meta          `json:"meta"`
+	Data  []CarResponse `json:"data"`
+	Links Links         `json:"links"`
+}
+
+// CarResponseData represents car response data
+type CarResponseData struct {
+	Data CarResponse `json:"data"`
+}
+
+// CarResponse represents response for a car
+type CarResponse struct {
+	ID               string `json:"id"`
+	CarLicenseNumber string `json:"carLicenseNumber"`
+	Manufacturer     string `json:"manufacturer"`
+	Model            string `json:"model"`
+	BasePrice        int    `json:"basePrice"`
+	PPH              int    `json:"PPH"`
+	Securitydeposit  int    `json:"securitydeposit"`
+	Available        bool   `json:"available"`
+	Retired          bool   `json:"retired"`
+	Version          int    `json:"version"`
+}
+
+// CarImportResponseData represents car import response data
+type CarImportResponseData struct {
+	Data CarImportResponse `json:"data"`
+}
+
+// CarImportResponse represents the outcome of a car import. Cars lists the
+// cars created, or that would be created on a dry run
+type CarImportResponse struct {
+	DryRun   bool                 `json:"dryRun"`
+	Total    int                  `json:"total"`
+	Imported int                  `json:"imported"`
+	Cars     []CarResponse        `json:"cars"`
+	Errors   []carimport.RowError `json:"errors"`
+}
+
+// PriceResponseData represents price quote response data
+type PriceResponseData struct {
+	Data PriceResponse `json:"data"`
+}
+
+// PriceResponse represents an itemised price quote for renting a car
+type PriceResponse struct {
+	CarID           string    `json:"carId"`
+	StartDateTime   time.Time `json:"startDateTime"`
+	EndDateTime     time.Time `json:"endDateTime"`
+	BilledMinutes   int       `json:"billedMinutes"`
+	BaseFare        int       `json:"baseFare"`
+	HourlyRate      int       `json:"hourlyRate"`
+	HourlyCharge    int       `json:"hourlyCharge"`
+	SecurityDeposit int       `json:"securityDeposit"`
+	Discount        int       `json:"discount"`
+	Taxes           int       `json:"taxes"`
+	Total           int       `json:"total"`
+}
+
+// BookingResponseData represents booking response data
+type BookingResponseData struct {
+	Data BookingResponse `json:"data"`
+}
+
+// BookingResponse represents response for a car booking
+type BookingResponse struct {
+	ID            string               `json:"id"`
+	CarID         string               `json:"carId"`
+	UserID        string               `json:"userId"`
+	Status        string               `json:"status"`
+	StartDateTime *time.Time           `json:"startDateTime"`
+	EndDateTime   *time.Time           `json:"endDateTime"`
+	Price         BookingPriceResponse `json:"price"`
+	RefundAmount  int                  `json:"refundAmount"`
+	CancelledAt   *time.Time           `json:"cancelledAt,omitempty"`
+	Adjustments   []AdjustmentResponse `json:"adjustments,omitempty"`
+	Version       int                  `json:"version"`
+}
+
+// AdjustmentResponse represents response for a change to the end of a booking
+type AdjustmentResponse struct {
+	ID                  string     `json:"id"`
+	Kind                string     `json:"kind"`
+	PreviousEndDateTime *time.Time `json:"previousEndDateTime"`
+	EndDateTime         *time.Time `json:"endDateTime"`
+	Amount              int        `json:"amount"`
+	Created             *time.Time `json:"created"`
+}
+
+// BookingPriceResponse represents the price snapshot a booking was made at
+type BookingPriceResponse struct {
+	BaseFare        int `json:"baseFare"`
+	HourlyRate      int `json:"hourlyRate"`
+	HourlyCharge    int `json:"hourlyCharge"`
+	SecurityDeposit int `json:"securityDeposit"`
+	Discount        int `json:"discount"`
+	Taxes           int `json:"taxes"`
+	Total           int `json:"total"`
+}
+
+// BookingListResponseData represents booking list response data
+type BookingListResponseData struct {
+	Meta  Meta              `json:"meta"`
+	Data  []BookingResponse `json:"data"`
+	Links Links             `json:"links"`
+}
+
+// WebhookResponseData represents webhook subscription response data
+type WebhookResponseData struct {
+	Data WebhookResponse `json:"data"`
+}
+
+// WebhookResponse represents response for webhook subscription. The secret
+// is only returned when the subscription is created
+type WebhookResponse struct {
+	ID         string     `json:"id"`
+	URL        string     `json:"url"`
+	EventTypes []string   `json:"eventTypes"`
+	CarIDs     []string   `json:"carIds"`
+	Secret     string     `json:"secret,omitempty"`
+	Created    *time.Time `json:"created"`
+}
+
+// WebhookListResponseData represents webhook subscription list response data
+type WebhookListResponseData struct {
+	Data []WebhookResponse `json:"data"`
+}
+
+// DeliveryResponseData represents webhook delivery response data
+type DeliveryResponseData struct {
+	Data DeliveryResponse `json:"data"`
+}
+
+// DeliveryResponse represents response for webhook delivery
+type DeliveryResponse struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscriptionId"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	Created        *time.Time      `json:"created"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// DeliveryListResponseData represents webhook delivery list response data
+type DeliveryListResponseData struct {
+	Data []DeliveryResponse `json:"data"`
 }
 
 // ErrorResponseData represents error response data
@@ -47,11 +279,157 @@ type ErrorResponse struct {
 	Status      string `json:"status"`
 	Description string `json:"description"`
 	Code        string `json:"code"`
+	// Fields details each invalid field of a request failing validation
+	Fields []validation.FieldError `json:"fields,omitempty"`
 }
 
 // mapFromModel maps fields from dao model to response
 func (response *UserResponseData) mapFromModel(account storage.User) {
 	response.Data.ID = account.ID
-	response.Data.mobile = account.Mobile
+	response.Data.Mobile = account.Mobile
+	response.Data.Name = account.Name
+	response.Data.Email = account.Email
+	response.Data.Role = string(account.Role)
+	response.Data.LicenceStatus = string(account.LicenceStatus)
+	response.Data.Status = "active"
+	if !account.Active {
+		response.Data.Status = "deleted"
+	}
+	response.Data.Created = account.Created
+	response.Data.Modified = account.Modified
+	response.Data.Version = account.Version
+}
+
+// mapFromModel maps fields from dao models to response
+func (response *UserHistoryResponseData) mapFromModel(changes []storage.UserChange) {
+	response.Data = make([]UserChangeResponse, len(changes))
+	for i, change := range changes {
+		response.Data[i] = UserChangeResponse{
+			ID:        change.ID,
+			Field:     change.Field,
+			OldValue:  change.OldValue,
+			NewValue:  change.NewValue,
+			ChangedBy: change.ChangedBy,
+			Version:   change.Version,
+			Created:   change.Created,
+		}
+	}
+}
+
+// mapFromModel maps fields from dao model to response
+func (response *LicenceResponseData) mapFromModel(licence storage.Licence) {
+	response.Data.UserID = licence.UserID
+	response.Data.Number = licence.Number
+	response.Data.IssuingState = licence.IssuingState
+	response.Data.ExpiresOn = licence.ExpiresOn.Format(storage.DateLayout)
+	response.Data.DateOfBirth = licence.DateOfBirth.Format(storage.DateLayout)
+	response.Data.Status = string(licence.Status)
+	response.Data.RejectionReason = licence.RejectionReason
+	response.Data.ReviewedAt = licence.ReviewedAt
+	response.Data.Submitted = licence.Submitted
+}
+
+// mapFromModel maps fields from dao model to response
+func (response *CarResponseData) mapFromModel(car storage.Car) {
+	response.Data.ID = car.ID
+	response.Data.CarLicenseNumber = car.CarLicenseNumber
+	response.Data.Manufacturer = car.Manufacturer
+	response.Data.Model = car.Model
+	response.Data.BasePrice = car.BasePrice
+	response.Data.PPH = car.PPH
+	response.Data.Securitydeposit = car.Securitydeposit
+	response.Data.Available = car.Available
+	response.Data.Retired = car.Retired
+	response.Data.Version = car.Version
+}
+
+// mapFromResult maps fields from import result to response
+func (response *CarImportResponseData) mapFromResult(result carimport.Result) {
+	response.Data.DryRun = result.DryRun
+	response.Data.Total = result.Total
+	response.Data.Imported = result.Imported
+	response.Data.Cars = []CarResponse{}
+	for _, car := range result.Cars {
+		var carResp CarResponseData
+		carResp.mapFromModel(car)
+		response.Data.Cars = append(response.Data.Cars, carResp.Data)
+	}
+	response.Data.Errors = append([]carimport.RowError{}, result.Errors...)
+}
+
+// mapFromModel maps fields from dao model to response
+func (response *BookingResponseData) mapFromModel(booking storage.CarBooking) {
+	response.Data.ID = booking.BookingId
+	response.Data.CarID = booking.CarID
+	response.Data.UserID = booking.UserID
+	response.Data.Status = string(booking.Status)
+	response.Data.StartDateTime = booking.StartDateTime
+	response.Data.EndDateTime = booking.EndDateTime
+	response.Data.Price.BaseFare = booking.BasePrice
+	response.Data.Price.HourlyRate = booking.PPH
+	response.Data.Price.HourlyCharge = booking.HourlyCharge
+	response.Data.Price.SecurityDeposit = booking.Securitydeposit
+	response.Data.Price.Discount = booking.Discount
+	response.Data.Price.Taxes = booking.Taxes
+	response.Data.Price.Total = booking.Total
+	response.Data.RefundAmount = booking.RefundAmount
+	response.Data.CancelledAt = booking.CancelledAt
+	response.Data.Version = booking.Version
+	response.Data.Adjustments = nil
+	for _, adjustment := range booking.Adjustments {
+		response.Data.Adjustments = append(response.Data.Adjustments, AdjustmentResponse{
+			ID:                  adjustment.ID,
+			Kind:                string(adjustment.Kind),
+			PreviousEndDateTime: adjustment.PreviousEndDateTime,
+			EndDateTime:         adjustment.EndDateTime,
+			Amount:              adjustment.Amount,
+			Created:             adjustment.Created,
+		})
+	}
+}
+
+// mapFromModel maps fields from dao model to response, leaving out the secret
+func (response *WebhookResponseData) mapFromModel(subscription storage.WebhookSubscription) {
+	response.Data.ID = subscription.ID
+	response.Data.URL = subscription.URL
+	response.Data.EventTypes = []string{}
+	for _, eventType := range subscription.EventTypes {
+		response.Data.EventTypes = append(response.Data.EventTypes, string(eventType))
+	}
+	response.Data.CarIDs = append([]string{}, subscription.CarIDs...)
+	response.Data.Created = subscription.Created
+}
+
+// mapFromModel maps fields from dao model to response
+func (response *DeliveryResponseData) mapFromModel(delivery storage.WebhookDelivery) {
+	response.Data.ID = delivery.ID
+	response.Data.SubscriptionID = delivery.SubscriptionID
+	response.Data.EventID = delivery.EventID
+	response.Data.EventType = string(delivery.EventType)
+	response.Data.Status = string(delivery.Status)
+	response.Data.Attempts = delivery.Attempts
+	response.Data.LastStatusCode = delivery.LastStatusCode
+	response.Data.LastError = delivery.LastError
+	response.Data.LastAttemptAt = delivery.LastAttemptAt
+	response.Data.DeliveredAt = delivery.DeliveredAt
+	response.Data.Created = delivery.Created
+	response.Data.Payload = json.RawMessage(delivery.Payload)
+	if delivery.Status == storage.DeliveryPending {
+		response.Data.NextAttemptAt = delivery.NextAttemptAt
+	}
+}
 
+// mapFromQuote maps fields from price quote to response
+func (response *PriceResponseData) mapFromQuote(quote pricing.Quote) {
+	response.Data.CarID = quote.CarID
+	response.Data.StartDateTime = quote.StartDateTime
+	response.Data.EndDateTime = quote.EndDateTime
+	response.Data.BilledMinutes = int(quote.BilledDuration / time.Minute)
+	response.Data.BaseFare = quote.BaseFare
+	response.Data.HourlyRate = quote.HourlyRate
+	response.Data.HourlyCharge = quote.HourlyCharge
+	response.Data.SecurityDeposit = quote.SecurityDeposit
+	response.Data.Discount = quote.Discount
+	response.Data.Taxes = quote.Taxes
+	response.Data.Total = quote.Total
 }
@@ -1,22 +1,71 @@
 package rest
 
 import (
+	"../auth"
+	"../config"
+	"../otp"
+	"../storage"
+	"../validation"
 	"github.com/labstack/echo/v4"
 )
 
-// InitRoutes initializes routes
-func InitRoutes() *echo.Echo {
+// InitRoutes initializes routes served from repositories of store as
+// configured by config. Callers are authenticated with tokens accepted by
+// verifier, except on routes browsing cars and prices and signing in. One-time
+// codes are sent with sender
+func InitRoutes(config *config.Config, store storage.Store, verifier auth.Verifier, sender otp.Sender) *echo.Echo {
 	e := echo.New()
+	e.Validator = validation.Validator{}
+	h := newHandler(config, store, sender)
+	idempotency := idempotent(store, config.Idempotency.TTL, config.Idempotency.Lease)
+	authn := authenticate(verifier, store)
 
-	e.GET("/", index)
-	e.GET("/health", health)
-	e.POST("/v1/user", createUser)
-	e.POST("/v1/cars", addCars)
-	e.GET("/v1/searchCars", listAccounts)            //contains query from given timeDate to given timeDate, returns the list of avialable cars
-	e.GET("/v1/calculatePrice", calculatePrice)      //contains query  from given timeDate to given timeDate
-	e.GET("/v1/user/:id/bookings", listUserBookings) //paticular user booking details
-	e.GET("/v1/cars/:id/bookings", listCarBookings)  //paticular car booking details
-	e.POST("/v1/cars/:id/book", bookCar)
+	// Route policies, by the roles admitted besides the owner of the account
+	// or booking acted on
+	fleet := allow(storage.RoleFleetManager, storage.RoleAdmin)
+	staff := allow(storage.RoleFleetManager, storage.RoleSupport, storage.RoleAdmin)
+	admins := allow(storage.RoleAdmin)
+	reviewers := allow(storage.RoleSupport, storage.RoleAdmin)
+	ownAccount := h.selfOr(storage.RoleSupport, storage.RoleAdmin)
+	ownBooking := h.bookingOwnerOr(storage.RoleFleetManager, storage.RoleSupport, storage.RoleAdmin)
+
+	e.GET("/", h.index)
+	e.GET("/health", h.health)
+	e.POST("/v1/auth/otp", h.requestOTP)                 //sends a one-time code to mobile_no
+	e.POST("/v1/auth/otp/verify", h.verifyOTP)           //signs in with mobile_no and code, returning a session token
+	e.POST("/v1/user", h.createUser, authn, idempotency) //registers the caller
+	e.GET("/v1/user/:id", h.getAccount, authn, ownAccount)
+	e.PATCH("/v1/user/:id", h.updateUser, authn, ownAccount) //JSON merge patch of mobile_no, name and email
+	e.GET("/v1/user/:id/history", h.listUserHistory, authn, ownAccount)
+	e.DELETE("/v1/user/:id", h.deleteAccount, authn, h.selfOr(storage.RoleAdmin))
+	e.PUT("/v1/user/:id/role", h.setUserRole, authn, admins)
+	e.PUT("/v1/user/:id/licence", h.submitLicence, authn, ownAccount) //replaces any licence submitted before and puts it up for review
+	e.GET("/v1/user/:id/licence", h.getLicence, authn, ownAccount)
+	e.PUT("/v1/user/:id/licence/review", h.reviewLicence, authn, reviewers) //verifies or rejects the licence
+	e.POST("/v1/cars", h.addCars, authn, fleet)
+	e.GET("/v1/cars", h.listCars) //contains query manufacturer, model, minPrice, maxPrice, available and retired
+	e.GET("/v1/cars/:id", h.getCar)
+	e.PATCH("/v1/cars/:id", h.updateCar, authn, fleet) //JSON merge patch of the car
+	e.DELETE("/v1/cars/:id", h.retireCar, authn, fleet)
+	e.POST("/v1/cars/import", h.importCars, authn, fleet)                 //CSV or JSON array of cars, validated only with query dryRun=true
+	e.GET("/v1/searchCars", h.searchCars)                                 //contains query from given timeDate to given timeDate, returns the list of avialable cars
+	e.GET("/v1/calculatePrice", h.calculatePrice)                         //contains query  from given timeDate to given timeDate
+	e.GET("/v1/user/:id/bookings", h.listUserBookings, authn, ownAccount) //paticular user booking details
+	e.GET("/v1/cars/:id/bookings", h.listCarBookings, authn, staff)       //paticular car booking details
+	e.POST("/v1/cars/:id/book", h.bookCar, authn, idempotency)            //books for the caller unless support or an admin gives user_id
+	e.GET("/v1/bookings/:id", h.getBooking, authn, ownBooking)
+	e.POST("/v1/bookings/:id/confirm", h.transitionBooking(storage.BookingConfirmed), authn, fleet)
+	e.POST("/v1/bookings/:id/start", h.transitionBooking(storage.BookingInProgress), authn, fleet)
+	e.POST("/v1/bookings/:id/complete", h.transitionBooking(storage.BookingCompleted), authn, fleet)
+	e.POST("/v1/bookings/:id/cancel", h.cancelBooking, authn, ownBooking)
+	e.POST("/v1/bookings/:id/extend", h.changeBookingEnd(storage.AdjustmentExtension), authn, ownBooking)
+	e.POST("/v1/bookings/:id/return", h.changeBookingEnd(storage.AdjustmentEarlyReturn), authn, ownBooking)
+	e.POST("/v1/webhooks", h.createWebhook, authn, admins) //URL, event types, optional car ids and secret deliveries are signed with
+	e.GET("/v1/webhooks", h.listWebhooks, authn, admins)
+	e.GET("/v1/webhooks/:id", h.getWebhook, authn, admins)
+	e.DELETE("/v1/webhooks/:id", h.deleteWebhook, authn, admins)
+	e.GET("/v1/webhooks/:id/deliveries", h.listWebhookDeliveries, authn, admins) //delivery log, newest first, contains query limit
+	e.POST("/v1/webhooks/:id/deliveries/:deliveryId/replay", h.replayWebhookDelivery, authn, admins)
 
 	return e
 }
@@ -4,64 +4,69 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"time"
 
+	"../config"
 	// mysql driver
 	"../logger"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-const connectionMaxLifetime = time.Minute * 3
-const maxOpenConnections = 10
-const maxIdleConnections = 10
+// MySQLStore implements the repositories on a MySQL database. It owns a
+// connection pool shared by all its operations, so a single store should be
+// created at startup and closed on shutdown
+type MySQLStore struct {
+	db     *sql.DB
+	dbName string
+}
 
-// Creates a new client for database
-func createClient(dbName string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn(dbName))
-	if err == nil {
-		db.SetConnMaxLifetime(connectionMaxLifetime)
-		db.SetMaxOpenConns(maxOpenConnections)
-		db.SetMaxIdleConns(maxIdleConnections)
+// NewMySQLStore returns a store backed by a pool of connections to the MySQL
+// database described by config
+func NewMySQLStore(config config.Database) (*MySQLStore, error) {
+	db, err := createClient(config, config.Name)
+	if err != nil {
+		return nil, err
 	}
-	return db, err
+	return &MySQLStore{db: db, dbName: config.Name}, nil
 }
 
-// Generates data source name
-func dsn(dbName string) string {
-	if len(os.Getenv("DB_USERNAME")) == 0 {
-		panic("Environment variable for database username is not set.")
-	}
+// Close closes the connection pool, waiting for queries in progress to finish
+func (store *MySQLStore) Close() error {
+	return store.db.Close()
+}
 
-	if len(os.Getenv("DB_PASSWORD")) == 0 {
-		panic("Environment variable for database password is not set.")
-	}
+// Stats returns statistics of the connection pool
+func (store *MySQLStore) Stats() sql.DBStats {
+	return store.db.Stats()
+}
 
-	if len(os.Getenv("DB_HOSTNAME")) == 0 {
-		panic("Environment variable for database hostname is not set.")
+// Creates a new client for database
+func createClient(config config.Database, dbName string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn(config, dbName))
+	if err == nil {
+		db.SetConnMaxLifetime(config.ConnectionMaxLifetime)
+		db.SetMaxOpenConns(config.MaxOpenConnections)
+		db.SetMaxIdleConns(config.MaxIdleConnections)
 	}
+	return db, err
+}
 
-	return fmt.Sprintf("%s:%s@tcp(%s)/%s", os.Getenv("DB_USERNAME"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOSTNAME"), dbName)
+// Generates data source name
+func dsn(config config.Database, dbName string) string {
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", config.Username, config.Password, config.Hostname, dbName)
 }
 
 // Health checks health of database
-func Health() error {
+func (store *MySQLStore) Health() error {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
 	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelfunc()
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
-			"error", err)
-		return err
-	}
-	defer db.Close()
-	err = db.PingContext(ctx)
+	err := store.db.PingContext(ctx)
 	if err != nil {
-		slog.Errorw("Unable to ping database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to ping database "+store.dbName,
 			"error", err)
 	}
 	return err
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUserNotFound is returned when an operation refers to a user that does
+// not exist or was deleted
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserAlreadyRegistered is returned when creating a user for a UID that
+// already has one
+var ErrUserAlreadyRegistered = errors.New("user already registered")
+
+// ErrLicenceNotFound is returned when reviewing the driving licence of a user
+// that has not submitted one
+var ErrLicenceNotFound = errors.New("driving licence not found")
+
+// ErrLicenceRegistered is returned when a driving licence is submitted that
+// another user already submitted
+var ErrLicenceRegistered = errors.New("driving licence registered to another user")
+
+// ErrOTPRateLimited is returned when a mobile number has been sent as many
+// one-time codes as allowed in the rate limit window
+var ErrOTPRateLimited = errors.New("too many one-time codes requested")
+
+// ErrCarNotFound is returned when an operation refers to a car that does not exist
+var ErrCarNotFound = errors.New("car not found")
+
+// ErrCarUnavailable is returned when booking a car that is retired or not
+// available
+var ErrCarUnavailable = errors.New("car unavailable")
+
+// ErrCarHasFutureBookings is returned when retiring a car that has bookings
+// which have not ended and are not cancelled
+var ErrCarHasFutureBookings = errors.New("car has future bookings")
+
+// ErrSubscriptionNotFound is returned when an operation refers to a webhook
+// subscription that does not exist or was deleted
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+// ErrDeliveryNotFound is returned when an operation refers to a webhook
+// delivery that does not exist
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// ErrBookingNotFound is returned when an operation refers to a booking that does not exist
+var ErrBookingNotFound = errors.New("booking not found")
+
+// ErrBookingClosed is returned when changing a booking that is completed,
+// cancelled or marked no-show
+var ErrBookingClosed = errors.New("booking can no longer be changed")
+
+// ErrInvalidAdjustment is returned when the new end of a booking does not
+// match the kind of adjustment, or does not leave the booking after its start
+var ErrInvalidAdjustment = errors.New("invalid end for booking adjustment")
+
+// BookingConflictError is returned when a booking overlaps an existing
+// booking of the same car
+type BookingConflictError struct {
+	CarID     string
+	BookingID string
+}
+
+func (e *BookingConflictError) Error() string {
+	return fmt.Sprintf("car %s is already booked in the requested window by booking %s", e.CarID, e.BookingID)
+}
+
+// LicenceError is returned when a booking is made for a user whose driving
+// licence does not allow it: the licence is missing, is not verified, or
+// expires before the booking ends
+type LicenceError struct {
+	UserID    string
+	Status    LicenceStatus
+	ExpiresOn *time.Time
+}
+
+func (e *LicenceError) Error() string {
+	switch e.Status {
+	case LicenceMissing:
+		return fmt.Sprintf("user %s has not submitted a driving licence", e.UserID)
+	case LicenceVerified:
+		return fmt.Sprintf("driving licence of user %s expires on %s, before the booking ends", e.UserID, e.ExpiresOn.Format(DateLayout))
+	}
+	return fmt.Sprintf("driving licence of user %s is %s, not verified", e.UserID, e.Status)
+}
+
+// DuplicateLicenseError is returned when a car is saved with the licence
+// number of another car
+type DuplicateLicenseError struct {
+	CarLicenseNumber string
+}
+
+func (e *DuplicateLicenseError) Error() string {
+	return fmt.Sprintf("a car with licence number %s already exists", e.CarLicenseNumber)
+}
+
+// VersionMismatchError is returned when a car or booking is changed on
+// condition of a version that is no longer its current version
+type VersionMismatchError struct {
+	ID       string
+	Expected int
+	Current  int
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("%s is at version %d, not %d", e.ID, e.Current, e.Expected)
+}
+
+// checkVersion returns a *VersionMismatchError when expected is set and is
+// not current
+func checkVersion(id string, expected int, current int) error {
+	if expected != 0 && expected != current {
+		return &VersionMismatchError{ID: id, Expected: expected, Current: current}
+	}
+	return nil
+}
+
+// InvalidTransitionError is returned when a booking cannot move from its
+// current status to the requested one
+type InvalidTransitionError struct {
+	BookingID string
+	From      BookingStatus
+	To        BookingStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("booking %s cannot move from %s to %s", e.BookingID, e.From, e.To)
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"../logger"
+)
+
+// ClaimIdempotencyKey saves record, replacing an expired record with the same
+// key. If an unexpired record with the key exists it is returned instead
+func (store *MySQLStore) ClaimIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for claiming idempotency key",
+			"error", err)
+		return nil, err
+	}
+
+	query := "DELETE FROM idempotencyKey WHERE idempotencyKey = ? AND expiresAt <= ?"
+	_, err = tx.ExecContext(ctx, query, record.Key, record.Created)
+	if err == nil {
+		query = "INSERT INTO idempotencyKey (idempotencyKey,requestHash,created,expiresAt) VALUES (?,?,?,?)"
+		_, err = tx.ExecContext(ctx, query, record.Key, record.RequestHash, record.Created, record.ExpiresAt)
+	}
+	if isDuplicateKey(err) {
+		tx.Rollback()
+		return store.getIdempotencyRecord(ctx, record.Key)
+	}
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to claim idempotency key as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+	}
+
+	return nil, err
+}
+
+// getIdempotencyRecord fetches the record of key
+func (store *MySQLStore) getIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	var record IdempotencyRecord
+	query := "SELECT idempotencyKey, requestHash, statusCode, contentType, body, created, expiresAt FROM idempotencyKey WHERE idempotencyKey = ?"
+	err := store.db.QueryRowContext(ctx, query, key).Scan(&record.Key, &record.RequestHash, &record.StatusCode, &record.ContentType, &record.Body, &record.Created, &record.ExpiresAt)
+	if err != nil {
+		slog.Errorw("Unable to fetch idempotency key",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// SaveIdempotentResponse stores the response to the request that claimed key,
+// replayed until expiresAt
+func (store *MySQLStore) SaveIdempotentResponse(key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "UPDATE idempotencyKey SET statusCode = ?, contentType = ?, body = ?, expiresAt = ? WHERE idempotencyKey = ?"
+	_, err := store.db.ExecContext(ctx, query, statusCode, contentType, body, expiresAt, key)
+	if err != nil {
+		slog.Errorw("Unable to save response for idempotency key",
+			"query", query,
+			"error", err)
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey deletes key so that the request can be retried
+func (store *MySQLStore) ReleaseIdempotencyKey(key string) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "DELETE FROM idempotencyKey WHERE idempotencyKey = ?"
+	_, err := store.db.ExecContext(ctx, query, key)
+	if err != nil {
+		slog.Errorw("Unable to release idempotency key",
+			"query", query,
+			"error", err)
+	}
+	return err
+}
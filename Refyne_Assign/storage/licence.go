@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"../logger"
+)
+
+// DateLayout is the layout of dates such as licence expiry and date of birth
+const DateLayout = "2006-01-02"
+
+// checkLicence checks that licence, nil when the user has none, allows the
+// user to book a car until end
+func checkLicence(userID string, licence *Licence, end time.Time) error {
+	if licence == nil {
+		return &LicenceError{UserID: userID, Status: LicenceMissing}
+	}
+	if licence.Status != LicenceVerified {
+		return &LicenceError{UserID: userID, Status: licence.Status}
+	}
+	if end.After(licence.ExpiresOn.AddDate(0, 0, 1)) {
+		return &LicenceError{UserID: userID, Status: licence.Status, ExpiresOn: licence.ExpiresOn}
+	}
+	return nil
+}
+
+// licenceColumns lists licence columns in the order scanned by scanLicence
+const licenceColumns = "userId, number, issuingState, expiresOn, dateOfBirth, status, rejectionReason, reviewedBy, reviewedAt, submitted"
+
+// scanLicence maps a row selected with licenceColumns to a licence
+func scanLicence(scan func(dest ...interface{}) error) (Licence, error) {
+	var licence Licence
+	err := scan(&licence.UserID, &licence.Number, &licence.IssuingState, &licence.ExpiresOn, &licence.DateOfBirth, &licence.Status,
+		&licence.RejectionReason, &licence.ReviewedBy, &licence.ReviewedAt, &licence.Submitted)
+	return licence, err
+}
+
+// SubmitLicence saves the driving licence of the active user, replacing any
+// licence submitted before, and puts it up for review. The user's licence
+// status is changed by changedBy in the same transaction
+func (store *MySQLStore) SubmitLicence(licence *Licence, changedBy string) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for submitting driving licence",
+			"error", err)
+		return err
+	}
+
+	// Locking the user first serialises submissions and reviews of its licence
+	_, err = updateUser(ctx, tx, licence.UserID, 0, changedBy, func(user *User) {
+		user.LicenceStatus = LicencePending
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	submitted := time.Now().UTC()
+	licence.Status = LicencePending
+	licence.RejectionReason = ""
+	licence.ReviewedBy = ""
+	licence.ReviewedAt = nil
+	licence.Submitted = &submitted
+
+	// The licence submitted before is deleted first, so that a duplicate key
+	// on insert is the licence of another user
+	query := "DELETE FROM licence WHERE userId = ?"
+	_, err = tx.ExecContext(ctx, query, licence.UserID)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to submit driving licence as the database query could not be executed")
+		tx.Rollback()
+		return err
+	}
+
+	query = "INSERT INTO licence (userId,number,issuingState,expiresOn,dateOfBirth,status,submitted) VALUES (?,?,?,?,?,?,?)"
+	_, err = tx.ExecContext(ctx, query, licence.UserID, licence.Number, licence.IssuingState, licence.ExpiresOn, licence.DateOfBirth, licence.Status, licence.Submitted)
+	if isDuplicateKey(err) {
+		tx.Rollback()
+		return ErrLicenceRegistered
+	}
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to submit driving licence as the database query could not be executed")
+		tx.Rollback()
+		return err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+	}
+	return err
+}
+
+// GetLicence fetches the driving licence of the user with given id
+func (store *MySQLStore) GetLicence(userID string) (*Licence, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + licenceColumns + " FROM licence WHERE userId = ?"
+	licence, err := scanLicence(store.db.QueryRowContext(ctx, query, userID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Errorw("Unable to fetch driving licence of account with id "+userID,
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	return &licence, nil
+}
+
+// ReviewLicence records the outcome of reviewing the driving licence of the
+// user with given id, verified or rejected for given reason. The user's
+// licence status is changed by reviewedBy in the same transaction
+func (store *MySQLStore) ReviewLicence(userID string, status LicenceStatus, reason string, reviewedBy string) (*Licence, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for reviewing driving licence",
+			"error", err)
+		return nil, err
+	}
+
+	_, err = updateUser(ctx, tx, userID, 0, reviewedBy, func(user *User) {
+		user.LicenceStatus = status
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query := "SELECT " + licenceColumns + " FROM licence WHERE userId = ? FOR UPDATE"
+	licence, err := scanLicence(tx.QueryRowContext(ctx, query, userID).Scan)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, ErrLicenceNotFound
+	}
+	if err != nil {
+		slog.Errorw("Unable to lock driving licence for review",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	reviewed := time.Now().UTC()
+	licence.Status = status
+	licence.RejectionReason = reason
+	licence.ReviewedBy = reviewedBy
+	licence.ReviewedAt = &reviewed
+
+	query = "UPDATE licence SET status = ?, rejectionReason = ?, reviewedBy = ?, reviewedAt = ? WHERE userId = ?"
+	_, err = tx.ExecContext(ctx, query, licence.Status, licence.RejectionReason, licence.ReviewedBy, licence.ReviewedAt, userID)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to review driving licence as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+	return &licence, nil
+}
@@ -0,0 +1,1018 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore implements the repositories in memory with the same semantics
+// as MySQLStore. It is safe for concurrent use
+type MemoryStore struct {
+	mu          sync.RWMutex
+	users       map[string]User
+	licences    map[string]Licence
+	cars        map[string]Car
+	bookings    map[string]CarBooking
+	idempotency map[string]IdempotencyRecord
+	// events holds the outbox in the order events were written
+	events []OutboxEvent
+	// subscriptions and deliveries are held in the order they were created
+	subscriptions []WebhookSubscription
+	deliveries    []WebhookDelivery
+	// challenges holds one-time code challenges in the order they were created
+	challenges []OTPChallenge
+	// history holds changes to users in the order they were made
+	history []UserChange
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:       map[string]User{},
+		licences:    map[string]Licence{},
+		cars:        map[string]Car{},
+		bookings:    map[string]CarBooking{},
+		idempotency: map[string]IdempotencyRecord{},
+	}
+}
+
+// Health reports the in-memory store as always healthy
+func (store *MemoryStore) Health() error {
+	return nil
+}
+
+// CreateUser creates a new active user
+func (store *MemoryStore) CreateUser(user *User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if len(user.UID) > 0 {
+		for _, existing := range store.users {
+			if existing.UID == user.UID {
+				return ErrUserAlreadyRegistered
+			}
+		}
+	}
+
+	if len(user.Role) == 0 {
+		user.Role = RoleCustomer
+	}
+	if len(user.LicenceStatus) == 0 {
+		user.LicenceStatus = LicenceMissing
+	}
+
+	created := time.Now().UTC()
+	user.ID = uuid.New().String()
+	user.Active = true
+	user.Created = &created
+	user.Modified = &created
+	user.Version = 1
+	store.users[user.ID] = *user
+	return nil
+}
+
+// UpdateUser changes the mobile, name and email of the active user to those
+// of user, recording each field changed by changedBy in the user's history
+func (store *MemoryStore) UpdateUser(user *User, changedBy string) error {
+	updated, err := store.changeUser(user.ID, user.Version, changedBy, func(current *User) {
+		current.Mobile = user.Mobile
+		current.Name = user.Name
+		current.Email = user.Email
+	})
+	if err != nil {
+		return err
+	}
+	*user = *updated
+	return nil
+}
+
+// SetUserRole assigns role to the active user with given id, recording the
+// change by changedBy in the user's history
+func (store *MemoryStore) SetUserRole(id string, role Role, changedBy string) (*User, error) {
+	return store.changeUser(id, 0, changedBy, func(current *User) {
+		current.Role = role
+	})
+}
+
+func (store *MemoryStore) changeUser(id string, expected int, changedBy string, change func(user *User)) (*User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.updateUser(id, expected, changedBy, change)
+}
+
+// updateUser applies change to the active user with given id, recording each
+// field changed in the user's history. The caller holds the lock
+func (store *MemoryStore) updateUser(id string, expected int, changedBy string, change func(user *User)) (*User, error) {
+	current, ok := store.users[id]
+	if !ok || !current.Active {
+		return nil, ErrUserNotFound
+	}
+	if err := checkVersion(id, expected, current.Version); err != nil {
+		return nil, err
+	}
+
+	updated := current
+	change(&updated)
+	changes := userChanges(current, updated)
+	if len(changes) == 0 {
+		return &current, nil
+	}
+
+	modified := time.Now().UTC()
+	updated.Modified = &modified
+	updated.Version = current.Version + 1
+	for _, c := range changes {
+		c.ID = uuid.New().String()
+		c.UserID = id
+		c.ChangedBy = changedBy
+		c.Version = updated.Version
+		c.Created = &modified
+		store.history = append(store.history, c)
+	}
+	store.users[id] = updated
+	return &updated, nil
+}
+
+// ListUserHistory fetches the changes made to the user with given id, oldest
+// first
+func (store *MemoryStore) ListUserHistory(id string) ([]UserChange, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var changes []UserChange
+	for _, c := range store.history {
+		if c.UserID == id {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// GetUserByUID fetches the active user signed in as uid
+func (store *MemoryStore) GetUserByUID(uid string) (*User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, user := range store.users {
+		if user.UID == uid && user.Active {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetAccount fetches an active user
+func (store *MemoryStore) GetAccount(id string) (*User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	user, ok := store.users[id]
+	if !ok || !user.Active {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// DeleteAccount deactivates a user, returning the number of users deactivated
+func (store *MemoryStore) DeleteAccount(id string) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, ok := store.users[id]
+	if !ok || !user.Active {
+		return 0, nil
+	}
+	user.Active = false
+	store.users[id] = user
+	return 1, nil
+}
+
+// SubmitLicence saves the driving licence of the active user, replacing any
+// licence submitted before, and puts it up for review
+func (store *MemoryStore) SubmitLicence(licence *Licence, changedBy string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.users[licence.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	for _, other := range store.licences {
+		if other.UserID != licence.UserID && other.IssuingState == licence.IssuingState && other.Number == licence.Number {
+			return ErrLicenceRegistered
+		}
+	}
+
+	_, err := store.updateUser(licence.UserID, 0, changedBy, func(user *User) {
+		user.LicenceStatus = LicencePending
+	})
+	if err != nil {
+		return err
+	}
+
+	submitted := time.Now().UTC()
+	licence.Status = LicencePending
+	licence.RejectionReason = ""
+	licence.ReviewedBy = ""
+	licence.ReviewedAt = nil
+	licence.Submitted = &submitted
+	store.licences[licence.UserID] = *licence
+	return nil
+}
+
+// GetLicence fetches the driving licence of the user with given id
+func (store *MemoryStore) GetLicence(userID string) (*Licence, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	licence, ok := store.licences[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &licence, nil
+}
+
+// ReviewLicence records the outcome of reviewing the driving licence of the
+// user with given id, verified or rejected for given reason
+func (store *MemoryStore) ReviewLicence(userID string, status LicenceStatus, reason string, reviewedBy string) (*Licence, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	licence, ok := store.licences[userID]
+	if !ok {
+		return nil, ErrLicenceNotFound
+	}
+
+	_, err := store.updateUser(userID, 0, reviewedBy, func(user *User) {
+		user.LicenceStatus = status
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reviewed := time.Now().UTC()
+	licence.Status = status
+	licence.RejectionReason = reason
+	licence.ReviewedBy = reviewedBy
+	licence.ReviewedAt = &reviewed
+	store.licences[userID] = licence
+	return &licence, nil
+}
+
+// CreateCar creates a new available car
+func (store *MemoryStore) CreateCar(car *Car) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.licenseTaken(car.CarLicenseNumber, "") {
+		return &DuplicateLicenseError{CarLicenseNumber: car.CarLicenseNumber}
+	}
+
+	car.ID = uuid.New().String()
+	car.Available = true
+	car.Version = 1
+	store.cars[car.ID] = *car
+	return nil
+}
+
+// CreateCars creates all cars or, if any licence number is taken, none of them
+func (store *MemoryStore) CreateCars(cars []Car) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, car := range cars {
+		if seen[car.CarLicenseNumber] || store.licenseTaken(car.CarLicenseNumber, "") {
+			return &DuplicateLicenseError{CarLicenseNumber: car.CarLicenseNumber}
+		}
+		seen[car.CarLicenseNumber] = true
+	}
+
+	for i := range cars {
+		cars[i].ID = uuid.New().String()
+		cars[i].Available = true
+		cars[i].Version = 1
+		store.cars[cars[i].ID] = cars[i]
+	}
+	return nil
+}
+
+// GetCar fetches car details
+func (store *MemoryStore) GetCar(id string) (*Car, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	car, ok := store.cars[id]
+	if !ok {
+		return nil, nil
+	}
+	return &car, nil
+}
+
+// ListCars fetches cars matching filter
+func (store *MemoryStore) ListCars(filter CarFilter) ([]Car, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var cars []Car
+	for _, car := range store.cars {
+		switch {
+		case len(filter.Manufacturer) > 0 && !strings.EqualFold(car.Manufacturer, filter.Manufacturer),
+			len(filter.Model) > 0 && !strings.EqualFold(car.Model, filter.Model),
+			filter.MinPPH > 0 && car.PPH < filter.MinPPH,
+			filter.MaxPPH > 0 && car.PPH > filter.MaxPPH,
+			filter.Available != nil && car.Available != *filter.Available,
+			!filter.IncludeRetired && car.Retired:
+			continue
+		}
+		cars = append(cars, car)
+	}
+
+	sort.Slice(cars, func(i, j int) bool {
+		a, b := cars[i], cars[j]
+		if a.Manufacturer != b.Manufacturer {
+			return a.Manufacturer < b.Manufacturer
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.CarLicenseNumber < b.CarLicenseNumber
+	})
+	return cars, nil
+}
+
+// GetCarsByLicense fetches cars having any of given licence numbers
+func (store *MemoryStore) GetCarsByLicense(numbers []string) ([]Car, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	wanted := map[string]bool{}
+	for _, number := range numbers {
+		wanted[number] = true
+	}
+
+	var cars []Car
+	for _, car := range store.cars {
+		if wanted[car.CarLicenseNumber] {
+			cars = append(cars, car)
+		}
+	}
+	sort.Slice(cars, func(i, j int) bool { return cars[i].ID < cars[j].ID })
+	return cars, nil
+}
+
+// SearchAvailableCars fetches cars that are available and have no booking
+// overlapping the given window
+func (store *MemoryStore) SearchAvailableCars(from time.Time, to time.Time) ([]Car, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var cars []Car
+	for _, car := range store.cars {
+		if car.Available && store.overlapping(car.ID, "", from, to) == nil {
+			cars = append(cars, car)
+		}
+	}
+	sort.Slice(cars, func(i, j int) bool { return cars[i].ID < cars[j].ID })
+	return cars, nil
+}
+
+// UpdateCar updates car details. A retired car stays unavailable
+func (store *MemoryStore) UpdateCar(car *Car) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	current, ok := store.cars[car.ID]
+	if !ok {
+		return ErrCarNotFound
+	}
+
+	if err := checkVersion(car.ID, car.Version, current.Version); err != nil {
+		return err
+	}
+
+	if store.licenseTaken(car.CarLicenseNumber, car.ID) {
+		return &DuplicateLicenseError{CarLicenseNumber: car.CarLicenseNumber}
+	}
+
+	car.Retired = current.Retired
+	car.Available = car.Available && !car.Retired
+	car.Version = current.Version + 1
+	store.cars[car.ID] = *car
+	store.events = append(store.events, newCarEvent(*car))
+	return nil
+}
+
+// RetireCar soft-retires a car that has no bookings which have not ended and
+// are not cancelled
+func (store *MemoryStore) RetireCar(id string, version int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	car, ok := store.cars[id]
+	if !ok {
+		return ErrCarNotFound
+	}
+
+	if err := checkVersion(id, version, car.Version); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, booking := range store.bookings {
+		open := booking.Status == BookingPending || booking.Status == BookingConfirmed || booking.Status == BookingInProgress
+		if booking.CarID == id && open && booking.EndDateTime.After(now) {
+			return ErrCarHasFutureBookings
+		}
+	}
+
+	car.Retired = true
+	car.Available = false
+	car.Version++
+	store.cars[id] = car
+	store.events = append(store.events, newCarEvent(car))
+	return nil
+}
+
+// CreateBooking books a car for the given window if no existing booking of
+// the car overlaps it
+func (store *MemoryStore) CreateBooking(carbooking *CarBooking) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	car, ok := store.cars[carbooking.CarID]
+	if !ok {
+		return ErrCarNotFound
+	}
+	if car.Retired || !car.Available {
+		return ErrCarUnavailable
+	}
+	if err := checkVersion(car.ID, carbooking.CarVersion, car.Version); err != nil {
+		return err
+	}
+
+	var held *Licence
+	if licence, ok := store.licences[carbooking.UserID]; ok {
+		held = &licence
+	}
+	if err := checkLicence(carbooking.UserID, held, *carbooking.EndDateTime); err != nil {
+		return err
+	}
+
+	if conflicting := store.overlapping(carbooking.CarID, "", *carbooking.StartDateTime, *carbooking.EndDateTime); conflicting != nil {
+		return &BookingConflictError{CarID: carbooking.CarID, BookingID: conflicting.BookingId}
+	}
+
+	carbooking.BookingId = uuid.New().String()
+	carbooking.Status = BookingPending
+	carbooking.Version = 1
+	store.bookings[carbooking.BookingId] = copyBooking(*carbooking)
+	store.events = append(store.events, newBookingEvent(EventBookingCreated, *carbooking))
+	return nil
+}
+
+// GetBooking fetches booking details
+func (store *MemoryStore) GetBooking(id string) (*CarBooking, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	booking, ok := store.bookings[id]
+	if !ok {
+		return nil, nil
+	}
+	booking = copyBooking(booking)
+	return &booking, nil
+}
+
+// GetUserBookings fetches bookings made by a user
+func (store *MemoryStore) GetUserBookings(userID string) ([]CarBooking, error) {
+	return store.listBookings(func(booking CarBooking) bool { return booking.UserID == userID }), nil
+}
+
+// GetCarBookings fetches bookings of a car
+func (store *MemoryStore) GetCarBookings(carID string) ([]CarBooking, error) {
+	return store.listBookings(func(booking CarBooking) bool { return booking.CarID == carID }), nil
+}
+
+// UpdateBookingStatus moves a booking to given status, enforcing the booking
+// status transition table
+func (store *MemoryStore) UpdateBookingStatus(id string, version int, status BookingStatus) (*CarBooking, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	booking, ok := store.bookings[id]
+	if !ok {
+		return nil, ErrBookingNotFound
+	}
+
+	if err := checkVersion(id, version, booking.Version); err != nil {
+		return nil, err
+	}
+
+	if !booking.Status.CanTransitionTo(status) {
+		return nil, &InvalidTransitionError{BookingID: id, From: booking.Status, To: status}
+	}
+
+	booking.Status = status
+	booking.Version++
+	store.bookings[id] = booking
+	if status == BookingCompleted {
+		store.events = append(store.events, newBookingEvent(EventBookingCompleted, booking))
+	}
+	booking = copyBooking(booking)
+	return &booking, nil
+}
+
+// CancelBooking cancels a booking, releasing its slot, and records the refund
+// computed by refund
+func (store *MemoryStore) CancelBooking(id string, version int, refund func(booking CarBooking) int) (*CarBooking, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	booking, ok := store.bookings[id]
+	if !ok {
+		return nil, ErrBookingNotFound
+	}
+
+	if err := checkVersion(id, version, booking.Version); err != nil {
+		return nil, err
+	}
+
+	if !booking.Status.CanTransitionTo(BookingCancelled) {
+		return nil, &InvalidTransitionError{BookingID: id, From: booking.Status, To: BookingCancelled}
+	}
+
+	cancelledAt := time.Now().UTC()
+	booking.RefundAmount = refund(copyBooking(booking))
+	booking.Status = BookingCancelled
+	booking.CancelledAt = &cancelledAt
+	booking.Version++
+	store.bookings[id] = booking
+	store.events = append(store.events, newBookingEvent(EventBookingCancelled, booking))
+	booking = copyBooking(booking)
+	return &booking, nil
+}
+
+// ChangeBookingEnd moves the end of a booking for an extension or early
+// return and records the amount reprice computes as an adjustment line
+func (store *MemoryStore) ChangeBookingEnd(id string, version int, kind AdjustmentKind, end time.Time, reprice func(booking CarBooking, car Car) int) (*CarBooking, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	booking, ok := store.bookings[id]
+	if !ok {
+		return nil, ErrBookingNotFound
+	}
+
+	if err := checkVersion(id, version, booking.Version); err != nil {
+		return nil, err
+	}
+
+	if err := checkAdjustment(booking, kind, end); err != nil {
+		return nil, err
+	}
+
+	previousEnd := *booking.EndDateTime
+	if kind == AdjustmentExtension {
+		var held *Licence
+		if licence, ok := store.licences[booking.UserID]; ok {
+			held = &licence
+		}
+		if err := checkLicence(booking.UserID, held, end); err != nil {
+			return nil, err
+		}
+		if conflicting := store.overlapping(booking.CarID, id, previousEnd, end); conflicting != nil {
+			return nil, &BookingConflictError{CarID: booking.CarID, BookingID: conflicting.BookingId}
+		}
+	}
+
+	created := time.Now().UTC()
+	adjustment := BookingAdjustment{
+		ID:                  uuid.New().String(),
+		BookingID:           id,
+		Kind:                kind,
+		PreviousEndDateTime: &previousEnd,
+		EndDateTime:         &end,
+		Amount:              reprice(copyBooking(booking), store.cars[booking.CarID]),
+		Created:             &created,
+	}
+
+	booking = copyBooking(booking)
+	booking.EndDateTime = &end
+	booking.Total += adjustment.Amount
+	booking.Adjustments = append(booking.Adjustments, adjustment)
+	booking.Version++
+	store.bookings[id] = booking
+	booking = copyBooking(booking)
+	return &booking, nil
+}
+
+// Utilisation reports, for every car not retired, the bookings that were
+// neither cancelled nor no-show and how long they overlap the window
+func (store *MemoryStore) Utilisation(from time.Time, to time.Time) ([]CarUtilisation, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var utilisation []CarUtilisation
+	for _, car := range store.cars {
+		if car.Retired {
+			continue
+		}
+
+		entry := CarUtilisation{Car: car}
+		for _, booking := range store.bookings {
+			if booking.CarID != car.ID || booking.Status == BookingCancelled || booking.Status == BookingNoShow {
+				continue
+			}
+			if !booking.StartDateTime.Before(to) || !booking.EndDateTime.After(from) {
+				continue
+			}
+
+			start, end := *booking.StartDateTime, *booking.EndDateTime
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			entry.Bookings++
+			entry.BookedDuration += end.Sub(start).Truncate(time.Second)
+		}
+		utilisation = append(utilisation, entry)
+	}
+
+	sort.Slice(utilisation, func(i, j int) bool {
+		a, b := utilisation[i].Car, utilisation[j].Car
+		if a.Manufacturer != b.Manufacturer {
+			return a.Manufacturer < b.Manufacturer
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.CarLicenseNumber < b.CarLicenseNumber
+	})
+	return utilisation, nil
+}
+
+// licenseTaken reports whether a car other than excludeID has given licence
+// number. Callers must hold the lock
+func (store *MemoryStore) licenseTaken(number string, excludeID string) bool {
+	for _, car := range store.cars {
+		if car.CarLicenseNumber == number && car.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimIdempotencyKey saves record unless an unexpired record with its key
+// exists, in which case that record is returned instead
+func (store *MemoryStore) ClaimIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	existing, ok := store.idempotency[record.Key]
+	if ok && existing.ExpiresAt.After(*record.Created) {
+		existing.Body = append([]byte(nil), existing.Body...)
+		return &existing, nil
+	}
+
+	store.idempotency[record.Key] = *record
+	return nil, nil
+}
+
+// SaveIdempotentResponse stores the response to the request that claimed key,
+// replayed until expiresAt
+func (store *MemoryStore) SaveIdempotentResponse(key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	record, ok := store.idempotency[key]
+	if !ok {
+		return nil
+	}
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	record.ExpiresAt = &expiresAt
+	store.idempotency[key] = record
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes key so that the request can be retried
+func (store *MemoryStore) ReleaseIdempotencyKey(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.idempotency, key)
+	return nil
+}
+
+// ClaimPendingEvents fetches, oldest first, at most limit events that are not
+// yet published and are due for an attempt at given time, and holds them
+// until claimedUntil
+func (store *MemoryStore) ClaimPendingEvents(now time.Time, limit int, claimedUntil time.Time) ([]OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var events []OutboxEvent
+	for i := range store.events {
+		if len(events) == limit {
+			break
+		}
+		event := &store.events[i]
+		if event.PublishedAt == nil && !event.NextAttemptAt.After(now) {
+			events = append(events, *event)
+			until := claimedUntil
+			event.NextAttemptAt = &until
+		}
+	}
+	return events, nil
+}
+
+// MarkEventPublished records that the event was published at given time
+func (store *MemoryStore) MarkEventPublished(id string, at time.Time) error {
+	return store.updateEvent(id, func(event *OutboxEvent) {
+		event.Attempts++
+		event.LastError = ""
+		event.PublishedAt = &at
+	})
+}
+
+// MarkEventFailed records a failed attempt to publish the event, which is
+// retried at nextAttemptAt
+func (store *MemoryStore) MarkEventFailed(id string, lastError string, nextAttemptAt time.Time) error {
+	return store.updateEvent(id, func(event *OutboxEvent) {
+		event.Attempts++
+		event.LastError = lastError
+		event.NextAttemptAt = &nextAttemptAt
+	})
+}
+
+// updateEvent applies update to the outbox event with given id
+func (store *MemoryStore) updateEvent(id string, update func(event *OutboxEvent)) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i := range store.events {
+		if store.events[i].ID == id {
+			update(&store.events[i])
+		}
+	}
+	return nil
+}
+
+// CreateSubscription saves a new webhook subscription
+func (store *MemoryStore) CreateSubscription(subscription *WebhookSubscription) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.subscriptions = append(store.subscriptions, *subscription)
+	return nil
+}
+
+// GetSubscription fetches the active webhook subscription with given id
+func (store *MemoryStore) GetSubscription(id string) (*WebhookSubscription, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, subscription := range store.subscriptions {
+		if subscription.ID == id && subscription.Active {
+			return &subscription, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListSubscriptions fetches active webhook subscriptions, oldest first
+func (store *MemoryStore) ListSubscriptions() ([]WebhookSubscription, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var subscriptions []WebhookSubscription
+	for _, subscription := range store.subscriptions {
+		if subscription.Active {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+// DeleteSubscription deactivates the webhook subscription with given id
+func (store *MemoryStore) DeleteSubscription(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i := range store.subscriptions {
+		if store.subscriptions[i].ID == id && store.subscriptions[i].Active {
+			store.subscriptions[i].Active = false
+			return nil
+		}
+	}
+	return ErrSubscriptionNotFound
+}
+
+// EnqueueDeliveries saves pending deliveries, skipping any of an event
+// already enqueued for the subscription
+func (store *MemoryStore) EnqueueDeliveries(deliveries []WebhookDelivery) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		enqueued := false
+		for _, existing := range store.deliveries {
+			if existing.SubscriptionID == delivery.SubscriptionID && existing.EventID == delivery.EventID {
+				enqueued = true
+				break
+			}
+		}
+		if !enqueued {
+			delivery.Status = DeliveryPending
+			store.deliveries = append(store.deliveries, delivery)
+		}
+	}
+	return nil
+}
+
+// ClaimPendingDeliveries fetches, oldest first, at most limit pending
+// deliveries to active subscriptions that are due for an attempt at given
+// time, and holds them until claimedUntil
+func (store *MemoryStore) ClaimPendingDeliveries(now time.Time, limit int, claimedUntil time.Time) ([]WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	active := map[string]bool{}
+	for _, subscription := range store.subscriptions {
+		active[subscription.ID] = subscription.Active
+	}
+
+	var deliveries []WebhookDelivery
+	for i := range store.deliveries {
+		if len(deliveries) == limit {
+			break
+		}
+		delivery := &store.deliveries[i]
+		if active[delivery.SubscriptionID] && delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, *delivery)
+			until := claimedUntil
+			delivery.NextAttemptAt = &until
+		}
+	}
+	return deliveries, nil
+}
+
+// ListDeliveries fetches at most limit deliveries to the subscription, newest
+// first
+func (store *MemoryStore) ListDeliveries(subscriptionID string, limit int) ([]WebhookDelivery, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var deliveries []WebhookDelivery
+	for i := len(store.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if store.deliveries[i].SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, store.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// RecordDeliveryAttempt saves the outcome of the latest attempt to deliver
+func (store *MemoryStore) RecordDeliveryAttempt(delivery *WebhookDelivery) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i := range store.deliveries {
+		if store.deliveries[i].ID == delivery.ID {
+			store.deliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+// ReplayDelivery makes the delivery pending and due now, with its attempts
+// reset so that retries back off from the start
+func (store *MemoryStore) ReplayDelivery(subscriptionID string, id string) (*WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i := range store.deliveries {
+		delivery := &store.deliveries[i]
+		if delivery.ID == id && delivery.SubscriptionID == subscriptionID {
+			now := time.Now().UTC()
+			delivery.Status = DeliveryPending
+			delivery.Attempts = 0
+			delivery.LastError = ""
+			delivery.NextAttemptAt = &now
+			replayed := *delivery
+			return &replayed, nil
+		}
+	}
+	return nil, ErrDeliveryNotFound
+}
+
+// CreateOTPChallenge saves challenge unless limit challenges were created for
+// its mobile number since given time
+func (store *MemoryStore) CreateOTPChallenge(challenge *OTPChallenge, since time.Time, limit int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	recent := 0
+	for _, existing := range store.challenges {
+		if existing.Mobile == challenge.Mobile && existing.Created.After(since) {
+			recent++
+		}
+	}
+	if recent >= limit {
+		return ErrOTPRateLimited
+	}
+
+	store.challenges = append(store.challenges, *challenge)
+	return nil
+}
+
+// LatestOTPChallenge fetches the challenge last created for mobile
+func (store *MemoryStore) LatestOTPChallenge(mobile string) (*OTPChallenge, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for i := len(store.challenges) - 1; i >= 0; i-- {
+		if store.challenges[i].Mobile == mobile {
+			challenge := store.challenges[i]
+			return &challenge, nil
+		}
+	}
+	return nil, nil
+}
+
+// RecordOTPAttempt counts an attempt at the challenge if it is unverified
+// and has had fewer than maxAttempts attempts
+func (store *MemoryStore) RecordOTPAttempt(id string, maxAttempts int) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i := range store.challenges {
+		challenge := &store.challenges[i]
+		if challenge.ID == id && challenge.VerifiedAt == nil && challenge.Attempts < maxAttempts {
+			challenge.Attempts++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// VerifyOTPChallenge marks the challenge verified at given time if it was not
+func (store *MemoryStore) VerifyOTPChallenge(id string, at time.Time) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for i := range store.challenges {
+		challenge := &store.challenges[i]
+		if challenge.ID == id && challenge.VerifiedAt == nil {
+			challenge.VerifiedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// overlapping returns a booking of the car other than excludeID that is not
+// cancelled and overlaps the window, or nil. Callers must hold the lock
+func (store *MemoryStore) overlapping(carID string, excludeID string, from time.Time, to time.Time) *CarBooking {
+	for _, booking := range store.bookings {
+		if booking.CarID != carID || booking.BookingId == excludeID || booking.Status == BookingCancelled {
+			continue
+		}
+		if booking.StartDateTime.Before(to) && booking.EndDateTime.After(from) {
+			return &booking
+		}
+	}
+	return nil
+}
+
+// listBookings fetches bookings matching filter, ordered by start
+func (store *MemoryStore) listBookings(filter func(booking CarBooking) bool) []CarBooking {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var bookings []CarBooking
+	for _, booking := range store.bookings {
+		if filter(booking) {
+			booking = copyBooking(booking)
+			// Lists are read without adjustment lines, as from MySQL
+			booking.Adjustments = nil
+			bookings = append(bookings, booking)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].StartDateTime.Before(*bookings[j].StartDateTime) })
+	return bookings
+}
+
+// copyBooking returns a copy of booking that shares no adjustment lines with it
+func copyBooking(booking CarBooking) CarBooking {
+	booking.Adjustments = append([]BookingAdjustment(nil), booking.Adjustments...)
+	return booking
+}
@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// start is the start of the windows booked in tests, far enough ahead that
+// bookings have not ended
+var start = time.Now().UTC().Truncate(time.Hour).AddDate(0, 1, 0)
+
+// at returns the time the given number of hours after start
+func at(hours float64) time.Time {
+	return start.Add(time.Duration(hours * float64(time.Hour)))
+}
+
+// newTestStore returns a store holding a user with a verified driving licence
+// and an available car
+func newTestStore(t *testing.T) (*MemoryStore, User, Car) {
+	t.Helper()
+	store := NewMemoryStore()
+
+	user := User{UID: "uid-1", Mobile: "+15550001111"}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	expires := start.AddDate(1, 0, 0)
+	born := start.AddDate(-30, 0, 0)
+	licence := Licence{UserID: user.ID, Number: "KA0120200001", IssuingState: "KA", ExpiresOn: &expires, DateOfBirth: &born}
+	if err := store.SubmitLicence(&licence, user.ID); err != nil {
+		t.Fatalf("SubmitLicence: %v", err)
+	}
+	if _, err := store.ReviewLicence(user.ID, LicenceVerified, "", "reviewer"); err != nil {
+		t.Fatalf("ReviewLicence: %v", err)
+	}
+
+	car := Car{CarLicenseNumber: "KA01AB1234", Manufacturer: "Maruti", Model: "Swift", BasePrice: 500, PPH: 100, Securitydeposit: 1000}
+	if err := store.CreateCar(&car); err != nil {
+		t.Fatalf("CreateCar: %v", err)
+	}
+	return store, user, car
+}
+
+// book books car for user from hour from to hour to after start, quoted at
+// the car's current version
+func book(store *MemoryStore, user User, car Car, from float64, to float64) (*CarBooking, error) {
+	current, err := store.GetCar(car.ID)
+	if err != nil {
+		return nil, err
+	}
+	startTime, endTime := at(from), at(to)
+	booking := CarBooking{CarID: car.ID, UserID: user.ID, StartDateTime: &startTime, EndDateTime: &endTime, CarVersion: current.Version}
+	if err := store.CreateBooking(&booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func TestMemoryStoreCreateBookingOverlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     float64
+		to       float64
+		conflict bool
+	}{
+		{"ends as existing starts", 8, 10, false},
+		{"starts as existing ends", 12, 14, false},
+		{"overlaps start", 9, 11, true},
+		{"overlaps end", 11, 13, true},
+		{"inside", 10.5, 11.5, true},
+		{"encloses", 9, 13, true},
+		{"same window", 10, 12, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, user, car := newTestStore(t)
+			existing, err := book(store, user, car, 10, 12)
+			if err != nil {
+				t.Fatalf("booking existing window: %v", err)
+			}
+
+			_, err = book(store, user, car, test.from, test.to)
+			var conflict *BookingConflictError
+			if test.conflict {
+				if !errors.As(err, &conflict) {
+					t.Fatalf("got error %v, want *BookingConflictError", err)
+				}
+				if conflict.BookingID != existing.BookingId {
+					t.Errorf("conflicting booking %s, want %s", conflict.BookingID, existing.BookingId)
+				}
+			} else if err != nil {
+				t.Fatalf("got error %v, want none", err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreCreateBookingIgnoresCancelledBookings(t *testing.T) {
+	store, user, car := newTestStore(t)
+	existing, err := book(store, user, car, 10, 12)
+	if err != nil {
+		t.Fatalf("booking existing window: %v", err)
+	}
+	if _, err = store.CancelBooking(existing.BookingId, 0, func(CarBooking) int { return 0 }); err != nil {
+		t.Fatalf("CancelBooking: %v", err)
+	}
+
+	if _, err = book(store, user, car, 10, 12); err != nil {
+		t.Fatalf("got error %v booking the window of a cancelled booking, want none", err)
+	}
+}
+
+func TestMemoryStoreCreateBookingLicence(t *testing.T) {
+	// review submits a licence for user expiring on the day after start and
+	// reviews it with status, unless status is missing
+	review := func(t *testing.T, store *MemoryStore, user User, status LicenceStatus) {
+		if status == LicenceMissing {
+			return
+		}
+		expires := start.Truncate(24*time.Hour).AddDate(0, 0, 1)
+		born := start.AddDate(-30, 0, 0)
+		licence := Licence{UserID: user.ID, Number: "KA0120200002", IssuingState: "KA", ExpiresOn: &expires, DateOfBirth: &born}
+		if err := store.SubmitLicence(&licence, user.ID); err != nil {
+			t.Fatalf("SubmitLicence: %v", err)
+		}
+		if status == LicencePending {
+			return
+		}
+		if _, err := store.ReviewLicence(user.ID, status, "", "reviewer"); err != nil {
+			t.Fatalf("ReviewLicence: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		status LicenceStatus
+		// hours is how long after start the booking ends
+		hours float64
+		// want is the status reported by the licence error, if any
+		want LicenceStatus
+	}{
+		{"no licence", LicenceMissing, 2, LicenceMissing},
+		{"licence pending review", LicencePending, 2, LicencePending},
+		{"licence rejected", LicenceRejected, 2, LicenceRejected},
+		{"ends before licence expires", LicenceVerified, 2, ""},
+		{"ends after licence expires", LicenceVerified, 72, LicenceVerified},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _, car := newTestStore(t)
+			user := User{UID: "uid-2", Mobile: "+15550002222"}
+			if err := store.CreateUser(&user); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			review(t, store, user, test.status)
+
+			_, err := book(store, user, car, 0, test.hours)
+			var licenceErr *LicenceError
+			switch {
+			case test.want == "" && err != nil:
+				t.Fatalf("got error %v, want none", err)
+			case test.want != "" && !errors.As(err, &licenceErr):
+				t.Fatalf("got error %v, want a licence error", err)
+			case test.want != "" && licenceErr.Status != test.want:
+				t.Errorf("got licence status %s, want %s", licenceErr.Status, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreCreateBookingUnavailableCar(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(store *MemoryStore, car Car) error
+	}{
+		{"not available", func(store *MemoryStore, car Car) error {
+			car.Available = false
+			return store.UpdateCar(&car)
+		}},
+		{"retired", func(store *MemoryStore, car Car) error {
+			return store.RetireCar(car.ID, 0)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, user, car := newTestStore(t)
+			if err := test.change(store, car); err != nil {
+				t.Fatalf("changing car: %v", err)
+			}
+
+			if _, err := book(store, user, car, 10, 12); err != ErrCarUnavailable {
+				t.Fatalf("got error %v, want ErrCarUnavailable", err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreUpdateBookingStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    []BookingStatus
+		invalid bool
+	}{
+		{"completed", []BookingStatus{BookingConfirmed, BookingInProgress, BookingCompleted}, false},
+		{"no show", []BookingStatus{BookingConfirmed, BookingNoShow}, false},
+		{"start unconfirmed", []BookingStatus{BookingInProgress}, true},
+		{"complete unstarted", []BookingStatus{BookingConfirmed, BookingCompleted}, true},
+		{"reopen completed", []BookingStatus{BookingConfirmed, BookingInProgress, BookingCompleted, BookingInProgress}, true},
+		{"no show once started", []BookingStatus{BookingConfirmed, BookingInProgress, BookingNoShow}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, user, car := newTestStore(t)
+			booking, err := book(store, user, car, 10, 12)
+			if err != nil {
+				t.Fatalf("CreateBooking: %v", err)
+			}
+
+			for i, status := range test.path {
+				last := i == len(test.path)-1
+				updated, err := store.UpdateBookingStatus(booking.BookingId, booking.Version, status)
+
+				var invalid *InvalidTransitionError
+				if last && test.invalid {
+					if !errors.As(err, &invalid) {
+						t.Fatalf("moving %s to %s: got error %v, want *InvalidTransitionError", booking.Status, status, err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("moving %s to %s: %v", booking.Status, status, err)
+				}
+				if updated.Status != status || updated.Version != booking.Version+1 {
+					t.Fatalf("got status %s version %d, want %s version %d", updated.Status, updated.Version, status, booking.Version+1)
+				}
+				booking = updated
+			}
+		})
+	}
+}
+
+func TestMemoryStoreChangeBookingEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		kind AdjustmentKind
+		end  float64
+		want error
+	}{
+		{"extend", AdjustmentExtension, 13, nil},
+		{"return early", AdjustmentEarlyReturn, 11, nil},
+		{"extend into next booking", AdjustmentExtension, 15, &BookingConflictError{}},
+		{"extend to earlier end", AdjustmentExtension, 11, ErrInvalidAdjustment},
+		{"return early after end", AdjustmentEarlyReturn, 13, ErrInvalidAdjustment},
+		{"return before start", AdjustmentEarlyReturn, 10, ErrInvalidAdjustment},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, user, car := newTestStore(t)
+			booking, err := book(store, user, car, 10, 12)
+			if err != nil {
+				t.Fatalf("CreateBooking: %v", err)
+			}
+			if _, err = book(store, user, car, 14, 16); err != nil {
+				t.Fatalf("booking next window: %v", err)
+			}
+			booking.Total = 2000
+			store.bookings[booking.BookingId] = *booking
+
+			// The amount is priced an hour's rate for every hour the end moves
+			reprice := func(booking CarBooking, car Car) int {
+				return int(at(test.end).Sub(*booking.EndDateTime).Hours()) * car.PPH
+			}
+			changed, err := store.ChangeBookingEnd(booking.BookingId, booking.Version, test.kind, at(test.end), reprice)
+
+			switch want := test.want.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+			case *BookingConflictError:
+				if !errors.As(err, &want) {
+					t.Fatalf("got error %v, want *BookingConflictError", err)
+				}
+				return
+			default:
+				if err != want {
+					t.Fatalf("got error %v, want %v", err, want)
+				}
+				return
+			}
+
+			amount := int(test.end-12) * car.PPH
+			if !changed.EndDateTime.Equal(at(test.end)) {
+				t.Errorf("end %v, want %v", changed.EndDateTime, at(test.end))
+			}
+			if changed.Total != 2000+amount {
+				t.Errorf("total %d, want %d", changed.Total, 2000+amount)
+			}
+			if len(changed.Adjustments) != 1 || changed.Adjustments[0].Kind != test.kind || changed.Adjustments[0].Amount != amount {
+				t.Errorf("adjustments %+v, want one %s of %d", changed.Adjustments, test.kind, amount)
+			}
+			if !changed.Adjustments[0].PreviousEndDateTime.Equal(at(12)) {
+				t.Errorf("previous end %v, want %v", changed.Adjustments[0].PreviousEndDateTime, at(12))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreChangeBookingEndLicence(t *testing.T) {
+	store, user, car := newTestStore(t)
+	booking, err := book(store, user, car, 10, 12)
+	if err != nil {
+		t.Fatalf("CreateBooking: %v", err)
+	}
+	noCharge := func(CarBooking, Car) int { return 0 }
+
+	// The licence of the test user expires a year after start
+	_, err = store.ChangeBookingEnd(booking.BookingId, 0, AdjustmentExtension, start.AddDate(1, 0, 2), noCharge)
+	var licence *LicenceError
+	if !errors.As(err, &licence) || licence.Status != LicenceVerified {
+		t.Fatalf("extending past the licence expiry: got error %v, want an expired licence error", err)
+	}
+
+	if _, err = store.ReviewLicence(user.ID, LicenceRejected, "blurred photo", "reviewer"); err != nil {
+		t.Fatalf("ReviewLicence: %v", err)
+	}
+	_, err = store.ChangeBookingEnd(booking.BookingId, 0, AdjustmentExtension, at(13), noCharge)
+	if !errors.As(err, &licence) || licence.Status != LicenceRejected {
+		t.Fatalf("extending with a rejected licence: got error %v, want a licence error", err)
+	}
+
+	// Returning early shortens the booking, which the licence need not allow
+	if _, err = store.ChangeBookingEnd(booking.BookingId, 0, AdjustmentEarlyReturn, at(11), noCharge); err != nil {
+		t.Fatalf("returning early with a rejected licence: %v", err)
+	}
+}
+
+func TestMemoryStoreChangeBookingEndClosed(t *testing.T) {
+	store, user, car := newTestStore(t)
+	booking, err := book(store, user, car, 10, 12)
+	if err != nil {
+		t.Fatalf("CreateBooking: %v", err)
+	}
+	if _, err = store.CancelBooking(booking.BookingId, 0, func(CarBooking) int { return 0 }); err != nil {
+		t.Fatalf("CancelBooking: %v", err)
+	}
+
+	_, err = store.ChangeBookingEnd(booking.BookingId, 0, AdjustmentExtension, at(13), func(CarBooking, Car) int { return 0 })
+	if err != ErrBookingClosed {
+		t.Fatalf("got error %v, want ErrBookingClosed", err)
+	}
+}
+
+func TestMemoryStoreVersionConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		// change changes the car or booking at version stale
+		change func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error
+	}{
+		{"update car", func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error {
+			car.Version = stale
+			return store.UpdateCar(&car)
+		}},
+		{"retire car", func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error {
+			return store.RetireCar(car.ID, stale)
+		}},
+		{"book car", func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error {
+			startTime, endTime := at(20), at(22)
+			return store.CreateBooking(&CarBooking{CarID: car.ID, UserID: user.ID, StartDateTime: &startTime, EndDateTime: &endTime, CarVersion: stale})
+		}},
+		{"update booking status", func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error {
+			_, err := store.UpdateBookingStatus(booking.BookingId, stale, BookingConfirmed)
+			return err
+		}},
+		{"cancel booking", func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error {
+			_, err := store.CancelBooking(booking.BookingId, stale, func(CarBooking) int { return 0 })
+			return err
+		}},
+		{"change booking end", func(store *MemoryStore, user User, car Car, booking CarBooking, stale int) error {
+			_, err := store.ChangeBookingEnd(booking.BookingId, stale, AdjustmentExtension, at(13), func(CarBooking, Car) int { return 0 })
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, user, car := newTestStore(t)
+			booking, err := book(store, user, car, 10, 12)
+			if err != nil {
+				t.Fatalf("CreateBooking: %v", err)
+			}
+
+			// Move the car and the booking on to version 2, so that version 1
+			// is stale for both
+			changed := car
+			changed.Model = "Dzire"
+			if err = store.UpdateCar(&changed); err != nil {
+				t.Fatalf("UpdateCar: %v", err)
+			}
+			if _, err = store.ChangeBookingEnd(booking.BookingId, booking.Version, AdjustmentExtension, at(12.5), func(CarBooking, Car) int { return 0 }); err != nil {
+				t.Fatalf("ChangeBookingEnd: %v", err)
+			}
+			before, _ := store.GetBooking(booking.BookingId)
+
+			err = test.change(store, user, changed, *before, 1)
+			var mismatch *VersionMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("got error %v, want *VersionMismatchError", err)
+			}
+			if mismatch.Expected != 1 || mismatch.Current != 2 {
+				t.Errorf("got expected version %d current %d, want 1 and 2", mismatch.Expected, mismatch.Current)
+			}
+
+			current, _ := store.GetCar(car.ID)
+			after, _ := store.GetBooking(booking.BookingId)
+			if current.Version != 2 || current.Retired || after.Version != 2 || after.Status != BookingPending {
+				t.Errorf("stale change was applied: car %+v, booking %+v", current, after)
+			}
+		})
+	}
+}
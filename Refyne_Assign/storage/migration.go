@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"../logger"
+)
+
+const migrationTimeout = 30 * time.Second
+
+// Migration represents a versioned change to the application schema. Up
+// applies the change and Down reverts it, each as an ordered list of statements
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// MigrationState represents a migration together with when it was applied
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrations lists schema migrations in version order. Applied migrations
+// must never be edited; change the schema by appending a new migration
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_user_table",
+		Up: []string{
+			"CREATE TABLE User(id VARCHAR(36) PRIMARY KEY, mobile VARCHAR(20) NOT NULL, active BOOLEAN NOT NULL DEFAULT true, created DATETIME DEFAULT CURRENT_TIMESTAMP, modified DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP)",
+		},
+		Down: []string{
+			"DROP TABLE User",
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_car_table",
+		Up: []string{
+			"CREATE TABLE Car(id VARCHAR(36) PRIMARY KEY, carLicenseNumber VARCHAR(20) NOT NULL UNIQUE, manufacturer VARCHAR(50) NOT NULL, model VARCHAR(50) NOT NULL, basePrice INT NOT NULL, PPH INT NOT NULL, securitydeposit INT NOT NULL, available BOOLEAN NOT NULL DEFAULT true, created DATETIME DEFAULT CURRENT_TIMESTAMP, modified DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP)",
+		},
+		Down: []string{
+			"DROP TABLE Car",
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_car_booking_table",
+		Up: []string{
+			"CREATE TABLE carBooking(BookingId VARCHAR(36) PRIMARY KEY, CarID VARCHAR(36) NOT NULL, UserID VARCHAR(36) NOT NULL, status ENUM('pending','confirmed','in_progress','completed','cancelled','no_show') NOT NULL DEFAULT 'pending', StartDateTime DATETIME NOT NULL, EndDateTime DATETIME NOT NULL, basePrice INT NOT NULL DEFAULT 0, PPH INT NOT NULL DEFAULT 0, hourlyCharge INT NOT NULL DEFAULT 0, securitydeposit INT NOT NULL DEFAULT 0, discount INT NOT NULL DEFAULT 0, taxes INT NOT NULL DEFAULT 0, total INT NOT NULL DEFAULT 0, refundAmount INT NOT NULL DEFAULT 0, cancelledAt DATETIME NULL, created DATETIME DEFAULT CURRENT_TIMESTAMP, CONSTRAINT fk_carBooking_car FOREIGN KEY (CarID) REFERENCES Car(id), CONSTRAINT fk_carBooking_user FOREIGN KEY (UserID) REFERENCES User(id))",
+		},
+		Down: []string{
+			"DROP TABLE carBooking",
+		},
+	},
+	{
+		Version: 4,
+		Name:    "index_car_booking_window",
+		Up: []string{
+			"CREATE INDEX idx_carBooking_car_window ON carBooking (CarID, StartDateTime, EndDateTime)",
+			"CREATE INDEX idx_carBooking_user ON carBooking (UserID, StartDateTime)",
+		},
+		Down: []string{
+			"DROP INDEX idx_carBooking_user ON carBooking",
+			"DROP INDEX idx_carBooking_car_window ON carBooking",
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_booking_adjustment_table",
+		Up: []string{
+			"CREATE TABLE bookingAdjustment(id VARCHAR(36) PRIMARY KEY, BookingId VARCHAR(36) NOT NULL, kind ENUM('extension','early_return') NOT NULL, previousEndDateTime DATETIME NOT NULL, EndDateTime DATETIME NOT NULL, amount INT NOT NULL, created DATETIME DEFAULT CURRENT_TIMESTAMP, CONSTRAINT fk_bookingAdjustment_booking FOREIGN KEY (BookingId) REFERENCES carBooking(BookingId), INDEX idx_bookingAdjustment_booking (BookingId, created))",
+		},
+		Down: []string{
+			"DROP TABLE bookingAdjustment",
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_car_retired",
+		Up: []string{
+			"ALTER TABLE Car ADD COLUMN retired BOOLEAN NOT NULL DEFAULT false",
+		},
+		Down: []string{
+			"ALTER TABLE Car DROP COLUMN retired",
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_row_versions",
+		Up: []string{
+			"ALTER TABLE Car ADD COLUMN version INT NOT NULL DEFAULT 1",
+			"ALTER TABLE carBooking ADD COLUMN version INT NOT NULL DEFAULT 1",
+		},
+		Down: []string{
+			"ALTER TABLE carBooking DROP COLUMN version",
+			"ALTER TABLE Car DROP COLUMN version",
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_idempotency_key_table",
+		Up: []string{
+			"CREATE TABLE idempotencyKey(idempotencyKey VARCHAR(255) PRIMARY KEY, requestHash CHAR(64) NOT NULL, statusCode INT NOT NULL DEFAULT 0, contentType VARCHAR(100) NOT NULL DEFAULT '', body MEDIUMBLOB NULL, created DATETIME NOT NULL, expiresAt DATETIME NOT NULL, INDEX idx_idempotencyKey_expires (expiresAt))",
+		},
+		Down: []string{
+			"DROP TABLE idempotencyKey",
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_outbox_event_table",
+		Up: []string{
+			"CREATE TABLE outboxEvent(id VARCHAR(36) PRIMARY KEY, type VARCHAR(50) NOT NULL, aggregateId VARCHAR(36) NOT NULL, payload BLOB NOT NULL, created DATETIME(6) NOT NULL, attempts INT NOT NULL DEFAULT 0, nextAttemptAt DATETIME(6) NOT NULL, publishedAt DATETIME(6) NULL, lastError VARCHAR(1000) NOT NULL DEFAULT '', INDEX idx_outboxEvent_pending (publishedAt, nextAttemptAt))",
+		},
+		Down: []string{
+			"DROP TABLE outboxEvent",
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_webhook_tables",
+		Up: []string{
+			"CREATE TABLE webhookSubscription(id VARCHAR(36) PRIMARY KEY, url VARCHAR(2048) NOT NULL, eventTypes VARCHAR(500) NOT NULL, carIds TEXT NOT NULL, secret VARCHAR(255) NOT NULL, active BOOLEAN NOT NULL DEFAULT true, created DATETIME NOT NULL)",
+			"CREATE TABLE webhookDelivery(id VARCHAR(36) PRIMARY KEY, subscriptionId VARCHAR(36) NOT NULL, eventId VARCHAR(36) NOT NULL, eventType VARCHAR(50) NOT NULL, payload BLOB NOT NULL, status ENUM('pending','delivered','failed') NOT NULL DEFAULT 'pending', attempts INT NOT NULL DEFAULT 0, lastStatusCode INT NOT NULL DEFAULT 0, lastError VARCHAR(1000) NOT NULL DEFAULT '', nextAttemptAt DATETIME(6) NOT NULL, lastAttemptAt DATETIME(6) NULL, deliveredAt DATETIME(6) NULL, created DATETIME(6) NOT NULL, UNIQUE KEY uq_webhookDelivery_event (subscriptionId, eventId), INDEX idx_webhookDelivery_pending (status, nextAttemptAt), CONSTRAINT fk_webhookDelivery_subscription FOREIGN KEY (subscriptionId) REFERENCES webhookSubscription(id))",
+		},
+		Down: []string{
+			"DROP TABLE webhookDelivery",
+			"DROP TABLE webhookSubscription",
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_user_uid",
+		Up: []string{
+			"ALTER TABLE User ADD COLUMN uid VARCHAR(128) NULL UNIQUE",
+		},
+		Down: []string{
+			"ALTER TABLE User DROP COLUMN uid",
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_user_role",
+		Up: []string{
+			"ALTER TABLE User ADD COLUMN role ENUM('customer','fleet_manager','support','admin') NOT NULL DEFAULT 'customer'",
+		},
+		Down: []string{
+			"ALTER TABLE User DROP COLUMN role",
+		},
+	},
+	{
+		Version: 13,
+		Name:    "create_otp_challenge_table",
+		Up: []string{
+			"CREATE TABLE otpChallenge(id VARCHAR(36) PRIMARY KEY, mobile VARCHAR(20) NOT NULL, codeHash CHAR(64) NOT NULL, attempts INT NOT NULL DEFAULT 0, expiresAt DATETIME(6) NOT NULL, verifiedAt DATETIME(6) NULL, created DATETIME(6) NOT NULL, INDEX idx_otpChallenge_mobile (mobile, created))",
+		},
+		Down: []string{
+			"DROP TABLE otpChallenge",
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_user_profile",
+		Up: []string{
+			"ALTER TABLE User ADD COLUMN name VARCHAR(100) NOT NULL DEFAULT '', ADD COLUMN email VARCHAR(254) NOT NULL DEFAULT '', ADD COLUMN licenceStatus ENUM('missing','pending','verified','rejected') NOT NULL DEFAULT 'missing', ADD COLUMN version INT NOT NULL DEFAULT 1",
+			"CREATE TABLE userHistory(id VARCHAR(36) PRIMARY KEY, userId VARCHAR(36) NOT NULL, field VARCHAR(32) NOT NULL, oldValue VARCHAR(254) NOT NULL, newValue VARCHAR(254) NOT NULL, changedBy VARCHAR(128) NOT NULL DEFAULT '', version INT NOT NULL, created DATETIME(6) NOT NULL, INDEX idx_userHistory_user (userId, created), CONSTRAINT fk_userHistory_user FOREIGN KEY (userId) REFERENCES User(id))",
+		},
+		Down: []string{
+			"DROP TABLE userHistory",
+			"ALTER TABLE User DROP COLUMN name, DROP COLUMN email, DROP COLUMN licenceStatus, DROP COLUMN version",
+		},
+	},
+	{
+		Version: 15,
+		Name:    "create_licence_table",
+		Up: []string{
+			"CREATE TABLE licence(userId VARCHAR(36) PRIMARY KEY, number VARCHAR(20) NOT NULL, issuingState VARCHAR(50) NOT NULL, expiresOn DATE NOT NULL, dateOfBirth DATE NOT NULL, status ENUM('pending','verified','rejected') NOT NULL DEFAULT 'pending', rejectionReason VARCHAR(255) NOT NULL DEFAULT '', reviewedBy VARCHAR(128) NOT NULL DEFAULT '', reviewedAt DATETIME(6) NULL, submitted DATETIME(6) NOT NULL, UNIQUE KEY uq_licence_number (issuingState, number), CONSTRAINT fk_licence_user FOREIGN KEY (userId) REFERENCES User(id))",
+		},
+		Down: []string{
+			"DROP TABLE licence",
+		},
+	},
+}
+
+// Migrations returns the schema migrations known to the application in version order
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// LatestVersion returns the schema version after applying all migrations
+func LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate applies all pending migrations
+func (store *MySQLStore) Migrate() error {
+	return store.MigrateTo(LatestVersion())
+}
+
+// MigrateTo migrates the schema up or down to given version, recording
+// every applied migration in the schema_migrations table
+func (store *MySQLStore) MigrateTo(version int) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	if version < 0 || version > LatestVersion() {
+		return fmt.Errorf("unknown schema version %d, latest is %d", version, LatestVersion())
+	}
+
+	current, err := currentVersion(store.db)
+	if err != nil {
+		slog.Errorw("Unable to read schema version of database "+store.dbName,
+			"error", err)
+		return err
+	}
+
+	if version >= current {
+		for _, migration := range migrations {
+			if migration.Version <= current || migration.Version > version {
+				continue
+			}
+			err = runMigration(store.db, migration, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > current || migration.Version <= version {
+			continue
+		}
+		err = runMigration(store.db, migration, migration.Down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationStatus lists all migrations with the time each was applied, if it was
+func (store *MySQLStore) MigrationStatus() ([]MigrationState, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancelfunc()
+
+	err := createMigrationTable(ctx, store.db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT version, applied FROM schema_migrations"
+	results, err := store.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Errorw("Unable to fetch applied migrations",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	applied := map[int]time.Time{}
+	for results.Next() {
+		var version int
+		var at time.Time
+		if err = results.Scan(&version, &at); err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, migration := range migrations {
+		state := MigrationState{Migration: migration}
+		if at, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// currentVersion returns the highest applied migration version
+func currentVersion(db *sql.DB) (int, error) {
+	ctx, cancelfunc := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancelfunc()
+
+	err := createMigrationTable(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// createMigrationTable creates the table tracking applied migrations
+func createMigrationTable(ctx context.Context, db *sql.DB) error {
+	query := "CREATE TABLE IF NOT EXISTS schema_migrations(version INT PRIMARY KEY, name VARCHAR(100) NOT NULL, applied DATETIME DEFAULT CURRENT_TIMESTAMP)"
+	_, err := db.ExecContext(ctx, query)
+	return err
+}
+
+// runMigration executes statements of a migration followed by the query
+// recording it. MySQL commits DDL implicitly, so a failed migration may be
+// partially applied and is reported with the statement that failed
+func runMigration(db *sql.DB, migration Migration, statements []string, record string, args ...interface{}) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancelfunc()
+
+	for _, query := range statements {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return migrationError(migration, query, err)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, record, args...); err != nil {
+		return migrationError(migration, record, err)
+	}
+
+	slog.Infow(fmt.Sprintf("Ran migration %d %s", migration.Version, migration.Name))
+	return nil
+}
+
+// migrationError logs and wraps an error raised running query of a migration
+func migrationError(migration Migration, query string, err error) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	slog.Errorw(fmt.Sprintf("Unable to run migration %d %s", migration.Version, migration.Name),
+		"query", query,
+		"error", err)
+	return fmt.Errorf("migration %d %s: %v", migration.Version, migration.Name, err)
+}
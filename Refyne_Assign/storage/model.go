@@ -6,9 +6,53 @@ import (
 
 // User represents User table fields
 type User struct {
-	ID     string
-	Mobile string
-	Active bool
+	ID string
+	// UID is the identity provider's id of the person signed in as the user
+	UID           string
+	Mobile        string
+	Name          string
+	Email         string
+	Role          Role
+	LicenceStatus LicenceStatus
+	Active        bool
+	Created       *time.Time
+	Modified      *time.Time
+	Version       int
+}
+
+// UserChange represents userHistory table fields, a line recording the change
+// of one field of a user and who changed it
+type UserChange struct {
+	ID       string
+	UserID   string
+	Field    string
+	OldValue string
+	NewValue string
+	// ChangedBy is the UID of the caller that made the change, empty when
+	// made by an operator
+	ChangedBy string
+	// Version is the version of the user the change produced
+	Version int
+	Created *time.Time
+}
+
+// Licence represents licence table fields, the driving licence a user
+// submitted and the outcome of its review. A user has at most one licence;
+// submitting another replaces it and puts it up for review again
+type Licence struct {
+	UserID       string
+	Number       string
+	IssuingState string
+	// ExpiresOn and DateOfBirth are dates, at midnight UTC. The licence is
+	// valid through the end of the day it expires on
+	ExpiresOn   *time.Time
+	DateOfBirth *time.Time
+	Status      LicenceStatus
+	// RejectionReason tells the user why a rejected licence was rejected
+	RejectionReason string
+	ReviewedBy      string
+	ReviewedAt      *time.Time
+	Submitted       *time.Time
 }
 
 // CAR represents car table fields
@@ -21,13 +65,159 @@ type Car struct {
 	PPH              int
 	Securitydeposit  int
 	Available        bool
+	Retired          bool
+	Version          int
+}
+
+// CarBooking represents carBooking table fields. The price fields are a
+// snapshot of the quote the booking was made at, against which the refund of
+// a cancelled booking is recorded
+type CarBooking struct {
+	BookingId       string
+	CarID           string
+	UserID          string
+	Status          BookingStatus
+	StartDateTime   *time.Time
+	EndDateTime     *time.Time
+	BasePrice       int
+	PPH             int
+	HourlyCharge    int
+	Securitydeposit int
+	Discount        int
+	Taxes           int
+	Total           int
+	RefundAmount    int
+	CancelledAt     *time.Time
+	Version         int
+	Adjustments     []BookingAdjustment
+	// CarVersion is the version of the car the price snapshot was quoted
+	// at. It is not saved; CreateBooking checks it under the car's lock
+	CarVersion int
+}
+
+// AdjustmentKind represents the reason a booking's end was changed
+type AdjustmentKind string
+
+// Booking adjustment kinds
+const (
+	AdjustmentExtension   AdjustmentKind = "extension"
+	AdjustmentEarlyReturn AdjustmentKind = "early_return"
+)
+
+// BookingAdjustment represents bookingAdjustment table fields, a line
+// recording a change to the end of a booking and the amount it was re-priced by
+type BookingAdjustment struct {
+	ID                  string
+	BookingID           string
+	Kind                AdjustmentKind
+	PreviousEndDateTime *time.Time
+	EndDateTime         *time.Time
+	Amount              int
+	Created             *time.Time
+}
+
+// IdempotencyRecord represents a request made with an idempotency key and,
+// once it has been handled, the response to replay for retries of it
+type IdempotencyRecord struct {
+	Key string
+	// RequestHash identifies the request the key was first used with
+	RequestHash string
+	// StatusCode is 0 while the first request is being handled
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	Created     *time.Time
+	// ExpiresAt is when the lease of the request being handled ends, and
+	// once it is handled, when its response stops being replayed
+	ExpiresAt *time.Time
+}
+
+// OutboxEvent represents a domain event written in the same transaction as
+// the change it describes, to be published by a relay
+type OutboxEvent struct {
+	ID          string
+	Type        EventType
+	AggregateID string
+	// Payload is the JSON representation of the changed car or booking
+	Payload       []byte
+	Created       *time.Time
+	Attempts      int
+	NextAttemptAt *time.Time
+	PublishedAt   *time.Time
+	LastError     string
+}
+
+// OTPChallenge represents a one-time code sent to a mobile number for signing
+// in. Only a hash of the code is stored
+type OTPChallenge struct {
+	ID       string
+	Mobile   string
+	CodeHash string
+	// Attempts counts the codes tried against the challenge
+	Attempts   int
+	ExpiresAt  *time.Time
+	VerifiedAt *time.Time
+	Created    *time.Time
+}
+
+// WebhookSubscription represents a partner's subscription to events, posted
+// to URL and signed with Secret
+type WebhookSubscription struct {
+	ID         string
+	URL        string
+	EventTypes []EventType
+	// CarIDs limits the subscription to events of given cars; empty means all
+	CarIDs  []string
+	Secret  string
+	Active  bool
+	Created *time.Time
+}
+
+// DeliveryStatus represents the state of a webhook delivery
+type DeliveryStatus string
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery represents an event to be posted to a subscription, with
+// the outcome of the latest attempt
+type WebhookDelivery struct {
+	ID             string
+	SubscriptionID string
+	EventID        string
+	EventType      EventType
+	// Payload is the body posted to the subscription
+	Payload        []byte
+	Status         DeliveryStatus
+	Attempts       int
+	LastStatusCode int
+	LastError      string
+	NextAttemptAt  *time.Time
+	LastAttemptAt  *time.Time
+	DeliveredAt    *time.Time
+	Created        *time.Time
+}
+
+// CarFilter selects cars to list. Zero values do not filter
+type CarFilter struct {
+	Manufacturer string
+	Model        string
+	// MinPPH and MaxPPH bound the price per hour, inclusive
+	MinPPH int
+	MaxPPH int
+	// Available selects cars by availability when set
+	Available *bool
+	// IncludeRetired lists retired cars too
+	IncludeRetired bool
 }
 
-// carBooking represents carBooking table fields
-type carBooking struct {
-	BookingId     string
-	CarID         string
-	UserID        string
-	StartDateTime *time.Time
-	EndDateTime   *time.Time
+// CarUtilisation represents how much a car was booked in a window
+type CarUtilisation struct {
+	Car            Car
+	Bookings       int
+	BookedDuration time.Duration
 }
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"../logger"
+)
+
+// CreateOTPChallenge saves challenge unless limit challenges were created for
+// its mobile number since given time. Challenges of the number are counted
+// with a locking read, so that concurrent requests cannot exceed the limit
+func (store *MySQLStore) CreateOTPChallenge(challenge *OTPChallenge, since time.Time, limit int) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for creating one-time code challenge",
+			"error", err)
+		return err
+	}
+
+	var recent int
+	query := "SELECT COUNT(*) FROM otpChallenge WHERE mobile = ? AND created > ? FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, challenge.Mobile, since).Scan(&recent)
+	if err == nil && recent >= limit {
+		tx.Rollback()
+		return ErrOTPRateLimited
+	}
+	if err == nil {
+		query = "INSERT INTO otpChallenge (id,mobile,codeHash,expiresAt,created) VALUES (?,?,?,?,?)"
+		_, err = tx.ExecContext(ctx, query, challenge.ID, challenge.Mobile, challenge.CodeHash, challenge.ExpiresAt, challenge.Created)
+	}
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to create one-time code challenge as the database query could not be executed")
+		tx.Rollback()
+		return err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+	}
+	return err
+}
+
+// LatestOTPChallenge fetches the challenge last created for mobile
+func (store *MySQLStore) LatestOTPChallenge(mobile string) (*OTPChallenge, error) {
+	slog := logger.InitSugarLogger()
+	var challenge OTPChallenge
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT id, mobile, codeHash, attempts, expiresAt, verifiedAt, created FROM otpChallenge WHERE mobile = ? ORDER BY created DESC LIMIT 1"
+	err := store.db.QueryRowContext(ctx, query, mobile).Scan(&challenge.ID, &challenge.Mobile, &challenge.CodeHash, &challenge.Attempts,
+		&challenge.ExpiresAt, &challenge.VerifiedAt, &challenge.Created)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		slog.Errorw("Unable to fetch one-time code challenge",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// RecordOTPAttempt counts an attempt at the challenge if it is unverified
+// and has had fewer than maxAttempts attempts
+func (store *MySQLStore) RecordOTPAttempt(id string, maxAttempts int) (bool, error) {
+	query := "UPDATE otpChallenge SET attempts = attempts + 1 WHERE id = ? AND verifiedAt IS NULL AND attempts < ?"
+	return store.updateOTPChallenge("Unable to record attempt at one-time code challenge", query, id, maxAttempts)
+}
+
+// VerifyOTPChallenge marks the challenge verified at given time if it was not
+func (store *MySQLStore) VerifyOTPChallenge(id string, at time.Time) (bool, error) {
+	query := "UPDATE otpChallenge SET verifiedAt = ? WHERE id = ? AND verifiedAt IS NULL"
+	return store.updateOTPChallenge("Unable to verify one-time code challenge", query, at, id)
+}
+
+// updateOTPChallenge runs a conditional update, reporting whether it applied
+func (store *MySQLStore) updateOTPChallenge(message string, query string, args ...interface{}) (bool, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	result, err := store.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Errorw(message,
+			"query", query,
+			"error", err)
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
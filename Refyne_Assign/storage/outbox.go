@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"../logger"
+	"github.com/google/uuid"
+)
+
+// EventType names a domain event
+type EventType string
+
+// Domain event types written to the outbox
+const (
+	EventBookingCreated   EventType = "booking.created"
+	EventBookingCancelled EventType = "booking.cancelled"
+	EventBookingCompleted EventType = "booking.completed"
+	EventCarUpdated       EventType = "car.updated"
+)
+
+// maxLastErrorLength is the longest publishing error kept for an event
+const maxLastErrorLength = 1000
+
+// bookingPayload is the payload of booking events
+type bookingPayload struct {
+	ID            string        `json:"id"`
+	CarID         string        `json:"carId"`
+	UserID        string        `json:"userId"`
+	Status        BookingStatus `json:"status"`
+	StartDateTime *time.Time    `json:"startDateTime"`
+	EndDateTime   *time.Time    `json:"endDateTime"`
+	Total         int           `json:"total"`
+	RefundAmount  int           `json:"refundAmount"`
+	CancelledAt   *time.Time    `json:"cancelledAt,omitempty"`
+	Version       int           `json:"version"`
+}
+
+// carPayload is the payload of car events
+type carPayload struct {
+	ID               string `json:"id"`
+	CarLicenseNumber string `json:"carLicenseNumber"`
+	Manufacturer     string `json:"manufacturer"`
+	Model            string `json:"model"`
+	BasePrice        int    `json:"basePrice"`
+	PPH              int    `json:"PPH"`
+	Securitydeposit  int    `json:"securitydeposit"`
+	Available        bool   `json:"available"`
+	Retired          bool   `json:"retired"`
+	Version          int    `json:"version"`
+}
+
+// newBookingEvent returns an event of given type for booking in its new state
+func newBookingEvent(eventType EventType, booking CarBooking) OutboxEvent {
+	payload, _ := json.Marshal(bookingPayload{
+		ID:            booking.BookingId,
+		CarID:         booking.CarID,
+		UserID:        booking.UserID,
+		Status:        booking.Status,
+		StartDateTime: booking.StartDateTime,
+		EndDateTime:   booking.EndDateTime,
+		Total:         booking.Total,
+		RefundAmount:  booking.RefundAmount,
+		CancelledAt:   booking.CancelledAt,
+		Version:       booking.Version,
+	})
+	return newEvent(eventType, booking.BookingId, payload)
+}
+
+// newCarEvent returns a car.updated event for car in its new state
+func newCarEvent(car Car) OutboxEvent {
+	payload, _ := json.Marshal(carPayload{
+		ID:               car.ID,
+		CarLicenseNumber: car.CarLicenseNumber,
+		Manufacturer:     car.Manufacturer,
+		Model:            car.Model,
+		BasePrice:        car.BasePrice,
+		PPH:              car.PPH,
+		Securitydeposit:  car.Securitydeposit,
+		Available:        car.Available,
+		Retired:          car.Retired,
+		Version:          car.Version,
+	})
+	return newEvent(EventCarUpdated, car.ID, payload)
+}
+
+func newEvent(eventType EventType, aggregateID string, payload []byte) OutboxEvent {
+	created := time.Now().UTC()
+	return OutboxEvent{
+		ID:            uuid.New().String(),
+		Type:          eventType,
+		AggregateID:   aggregateID,
+		Payload:       payload,
+		Created:       &created,
+		NextAttemptAt: &created,
+	}
+}
+
+// insertEvent writes event to the outbox inside the transaction making the
+// change it describes, so that the event is published if and only if the
+// change commits. The caller rolls back on error
+func insertEvent(ctx context.Context, tx *sql.Tx, event OutboxEvent) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	query := "INSERT INTO outboxEvent (id,type,aggregateId,payload,created,nextAttemptAt) VALUES (?,?,?,?,?,?)"
+	_, err := tx.ExecContext(ctx, query, event.ID, event.Type, event.AggregateID, event.Payload, event.Created, event.NextAttemptAt)
+	if err != nil {
+		slog.Errorw("Unable to write event to outbox",
+			"query", query,
+			"type", event.Type,
+			"error", err)
+	}
+	return err
+}
+
+// ClaimPendingEvents fetches, oldest first, at most limit events that are not
+// yet published and are due for an attempt at given time, and holds them from
+// other relays until claimedUntil. Events locked by another relay claiming
+// them are skipped. An event neither marked published nor failed by then is
+// due again, so that events claimed by a relay that stopped are not lost
+func (store *MySQLStore) ClaimPendingEvents(now time.Time, limit int, claimedUntil time.Time) ([]OutboxEvent, error) {
+	slog := logger.InitSugarLogger()
+	var events []OutboxEvent
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for claiming outbox events",
+			"error", err)
+		return nil, err
+	}
+
+	query := "SELECT id, type, aggregateId, payload, created, attempts, nextAttemptAt, lastError FROM outboxEvent WHERE publishedAt IS NULL AND nextAttemptAt <= ? ORDER BY created, id LIMIT ? FOR UPDATE SKIP LOCKED"
+	results, err := tx.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		slog.Errorw("Unable to fetch pending outbox events",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	for results.Next() {
+		var event OutboxEvent
+		err = results.Scan(&event.ID, &event.Type, &event.AggregateID, &event.Payload, &event.Created, &event.Attempts, &event.NextAttemptAt, &event.LastError)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			results.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(events) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	args := []interface{}{claimedUntil}
+	for _, event := range events {
+		args = append(args, event.ID)
+	}
+	query = "UPDATE outboxEvent SET nextAttemptAt = ? WHERE id IN (?" + strings.Repeat(",?", len(events)-1) + ")"
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to claim outbox events as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkEventPublished records that the event was published at given time
+func (store *MySQLStore) MarkEventPublished(id string, at time.Time) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "UPDATE outboxEvent SET publishedAt = ?, attempts = attempts + 1, lastError = '' WHERE id = ?"
+	_, err := store.db.ExecContext(ctx, query, at, id)
+	if err != nil {
+		slog.Errorw("Unable to mark outbox event published",
+			"query", query,
+			"error", err)
+	}
+	return err
+}
+
+// MarkEventFailed records a failed attempt to publish the event, which is
+// retried at nextAttemptAt
+func (store *MySQLStore) MarkEventFailed(id string, lastError string, nextAttemptAt time.Time) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	if len(lastError) > maxLastErrorLength {
+		lastError = lastError[:maxLastErrorLength]
+	}
+
+	query := "UPDATE outboxEvent SET attempts = attempts + 1, lastError = ?, nextAttemptAt = ? WHERE id = ?"
+	_, err := store.db.ExecContext(ctx, query, lastError, nextAttemptAt, id)
+	if err != nil {
+		slog.Errorw("Unable to record failed attempt to publish outbox event",
+			"query", query,
+			"error", err)
+	}
+	return err
+}
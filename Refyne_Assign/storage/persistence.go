@@ -2,20 +2,23 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"os"
+	"strings"
 	"time"
 
+	"../config"
 	"../logger"
+	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 )
 
 // CreateDatabase creates database for application on server
-func CreateDatabase(dbname string) error {
+func CreateDatabase(config config.Database) error {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient("")
+	db, err := createClient(config, "")
 	if err != nil {
 		slog.Errorw("Unable to create database client",
 			"error", err)
@@ -26,7 +29,7 @@ func CreateDatabase(dbname string) error {
 	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelfunc()
 
-	query := "CREATE DATABASE IF NOT EXISTS " + os.Getenv("DB_NAME")
+	query := "CREATE DATABASE IF NOT EXISTS " + config.Name
 	res, err := db.ExecContext(ctx, query)
 	if err != nil {
 		slog.Errorw("Unable to execute query",
@@ -50,75 +53,93 @@ func CreateDatabase(dbname string) error {
 	return err
 }
 
-// CreateTables creates table(s) required in application database
-func CreateTables() error {
+// CreateAccount ne user
+func (store *MySQLStore) CreateUser(user *User) error {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
+	user.ID = uuid.New().String()
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to begin database transaction for creating new account",
 			"error", err)
 		return err
 	}
 
-	query := "CREATE TABLE IF NOT EXISTS account(id VARCHAR(36) PRIMARY KEY, created DATETIME DEFAULT CURRENT_TIMESTAMP, modified DATETIME DEFAULT CURRENT_TIMESTAMP, payment_processor_id VARCHAR(50), payment_processor VARCHAR(20), wallet_id VARCHAR(36) NOT NULL UNIQUE, user_id VARCHAR(50) NOT NULL UNIQUE, status ENUM('active','blocked'), active BOOLEAN DEFAULT true)"
+	var uid interface{}
+	if len(user.UID) > 0 {
+		uid = user.UID
+	}
 
-	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelfunc()
+	if len(user.Role) == 0 {
+		user.Role = RoleCustomer
+	}
 
-	res, err := db.ExecContext(ctx, query)
+	if len(user.LicenceStatus) == 0 {
+		user.LicenceStatus = LicenceMissing
+	}
+
+	created := time.Now().UTC()
+	user.Active = true
+	user.Created = &created
+	user.Modified = &created
+	user.Version = 1
+	query := "INSERT INTO User (id,uid,mobile,name,email,role,licenceStatus,active,created,modified,version) VALUES (?, ?, ?, ?, ?, ?, ?, true, ?, ?, 1)"
+	_, err = tx.ExecContext(ctx, query, user.ID, uid, user.Mobile, user.Name, user.Email, user.Role, user.LicenceStatus, user.Created, user.Modified)
+	if isDuplicateKey(err) {
+		tx.Rollback()
+		return ErrUserAlreadyRegistered
+	}
 	if err != nil {
-		slog.Errorw("Unable to create account table in database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to execute query in database transaction",
 			"query", query,
 			"error", err)
+		slog.Infow("Rolling back transaction to create account as the database query could not be executed")
+		tx.Rollback()
 		return err
 	}
 
-	no, err := res.RowsAffected()
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
 	if err != nil {
-		slog.Errorw("Unable to fetch rows affected",
-			"query", query,
+		slog.Errorw("Unable to commit transaction to database",
 			"error", err)
-		return err
 	}
 
-	msg := fmt.Sprintf("%d rows affected on running query", no)
-	slog.Infow(msg,
-		"query", query)
-
 	return err
 }
 
-// CreateAccount ne user
-func CreateUser(user *User) error {
+// Creat Car
+func (store *MySQLStore) CreateCar(car *Car) error {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
-	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
-			"error", err)
-		return err
-	}
-
-	user.ID = uuid.New().String()
+	car.ID = uuid.New().String()
 
 	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelfunc()
 
 	// Begin database transaction
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
 		slog.Errorw("Unable to begin database transaction for creating new account",
 			"error", err)
 		return err
 	}
 
-	query := "INSERT INTO User (id,mobile, active) VALUES (?, ?, true)"
-	_, err = tx.ExecContext(ctx, query, user.ID, user.Mobile, user.Active)
+	car.Available = true
+	car.Version = 1
+	query := "INSERT INTO Car (id,model,manufacturer,carLicenseNumber,basePrice,securitydeposit,PPH,available) VALUES (?,?,?,?,?,?,?,?)"
+	_, err = tx.ExecContext(ctx, query, car.ID, car.Model, car.Manufacturer, car.CarLicenseNumber, car.BasePrice, car.Securitydeposit, car.PPH, car.Available)
+	if isDuplicateKey(err) {
+		tx.Rollback()
+		return &DuplicateLicenseError{CarLicenseNumber: car.CarLicenseNumber}
+	}
 	if err != nil {
 		slog.Errorw("Unable to execute query in database transaction",
 			"query", query,
@@ -138,42 +159,53 @@ func CreateUser(user *User) error {
 	return err
 }
 
-// Creat Car
-func CreateCar(car *Car) error {
+// CreateCars creates cars in a single transaction, so that either all of
+// them or none are created
+func (store *MySQLStore) CreateCars(cars []Car) error {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
-	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
-			"error", err)
-		return err
-	}
-
-	car.ID = uuid.New().String()
-
-	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancelfunc()
 
 	// Begin database transaction
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
-		slog.Errorw("Unable to begin database transaction for creating new account",
+		slog.Errorw("Unable to begin database transaction for creating cars",
 			"error", err)
 		return err
 	}
 
-	query := "INSERT INTO Car (id,model,manufacturer,carLicenseNumber,basePrice,securitydeposit,PPH,available) VALUES (?,?,?,?,?,?,?, true)"
-	_, err = tx.ExecContext(ctx, query, car.ID, car.Model, car.Manufacturer, car.CarLicenseNumber, car.BasePrice, car.Securitydeposit, car.PPH, car.Available)
+	query := "INSERT INTO Car (id,model,manufacturer,carLicenseNumber,basePrice,securitydeposit,PPH,available) VALUES (?,?,?,?,?,?,?,?)"
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
-		slog.Errorw("Unable to execute query in database transaction",
+		slog.Errorw("Unable to prepare query in database transaction",
 			"query", query,
 			"error", err)
-		slog.Infow("Rolling back transaction to create account as the database query could not be executed")
 		tx.Rollback()
 		return err
 	}
+	defer stmt.Close()
+
+	for i := range cars {
+		car := &cars[i]
+		car.ID = uuid.New().String()
+		car.Available = true
+		car.Version = 1
+		_, err = stmt.ExecContext(ctx, car.ID, car.Model, car.Manufacturer, car.CarLicenseNumber, car.BasePrice, car.Securitydeposit, car.PPH, car.Available)
+		if isDuplicateKey(err) {
+			tx.Rollback()
+			return &DuplicateLicenseError{CarLicenseNumber: car.CarLicenseNumber}
+		}
+		if err != nil {
+			slog.Errorw("Unable to execute query in database transaction",
+				"query", query,
+				"error", err)
+			slog.Infow("Rolling back transaction to create cars as the database query could not be executed")
+			tx.Rollback()
+			return err
+		}
+	}
 
 	// Commit the change if all queries ran successfully
 	err = tx.Commit()
@@ -185,160 +217,937 @@ func CreateCar(car *Car) error {
 	return err
 }
 
-func CreateBooking(carbooking *carBooking) error {
+// GetCar fetches car details from database
+func (store *MySQLStore) GetCar(id string) (*Car, error) {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + carColumns + " FROM Car c WHERE c.id = ?"
+	car, err := scanCar(store.db.QueryRowContext(ctx, query, id).Scan)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
 	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to map data fetched from database "+store.dbName+" for car with id "+id,
+			"query", query,
 			"error", err)
-		return err
+		return nil, err
 	}
 
-	carbooking.BookingId = uuid.New().String()
+	return &car, nil
+}
+
+// UpdateCar updates car details in database
+func (store *MySQLStore) UpdateCar(car *Car) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
 
 	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelfunc()
 
 	// Begin database transaction
-	tx, err := db.BeginTx(ctx, nil)
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
-		slog.Errorw("Unable to begin database transaction for creating new account",
+		slog.Errorw("Unable to begin database transaction for updating car",
 			"error", err)
 		return err
 	}
 
-	// check car avaibality
+	query := "SELECT " + carColumns + " FROM Car c WHERE c.id = ? FOR UPDATE"
+	current, err := scanCar(tx.QueryRowContext(ctx, query, car.ID).Scan)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrCarNotFound
+	}
+	if err != nil {
+		slog.Errorw("Unable to lock car for update",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return err
+	}
 
-	isAvaliable := true
-	if isAvaliable == true {
-		query := "INSERT INTO carBooking (BookingId,CarID,UserID,StartDateTime,EndDateTime) VALUES (?,?,?,?,?)"
-		_, err = tx.ExecContext(ctx, query, carbooking.BookingId, carbooking.CarID, carbooking.UserID, carbooking.StartDateTime, carbooking.EndDateTime)
-		if err != nil {
-			slog.Errorw("Unable to execute query in database transaction",
-				"query", query,
-				"error", err)
-			slog.Infow("Rolling back transaction to create account as the database query could not be executed")
-			tx.Rollback()
-			return err
-		}
+	if err = checkVersion(car.ID, car.Version, current.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		// Commit the change if all queries ran successfully
-		err = tx.Commit()
-		if err != nil {
-			slog.Errorw("Unable to commit transaction to database",
-				"error", err)
-		}
+	// A retired car stays unavailable
+	car.Retired = current.Retired
+	car.Available = car.Available && !car.Retired
+	car.Version = current.Version + 1
+
+	query = "UPDATE Car SET carLicenseNumber = ?, manufacturer = ?, model = ?, basePrice = ?, PPH = ?, securitydeposit = ?, available = ?, version = version + 1 WHERE id = ?"
+	_, err = tx.ExecContext(ctx, query, car.CarLicenseNumber, car.Manufacturer, car.Model, car.BasePrice, car.PPH, car.Securitydeposit, car.Available, car.ID)
+	if isDuplicateKey(err) {
+		tx.Rollback()
+		return &DuplicateLicenseError{CarLicenseNumber: car.CarLicenseNumber}
+	}
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to update car as the database query could not be executed")
+		tx.Rollback()
+		return err
+	}
+
+	err = insertEvent(ctx, tx, newCarEvent(*car))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
 	}
+
 	return err
 }
 
-// GetAccount fetches account details from database
-func GetAccount(id string) (*User, error) {
+// RetireCar soft-retires a car, making it permanently unavailable. Cars with
+// bookings that have not ended and are not cancelled cannot be retired
+func (store *MySQLStore) RetireCar(id string, version int) error {
 	slog := logger.InitSugarLogger()
-	var account User
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
 	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to begin database transaction for retiring car",
 			"error", err)
-		return nil, err
+		return err
 	}
 
-	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelfunc()
+	// Lock the car row so that no booking can be made while retiring it
+	query := "SELECT " + carColumns + " FROM Car c WHERE c.id = ? FOR UPDATE"
+	car, err := scanCar(tx.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrCarNotFound
+	}
+	if err != nil {
+		slog.Errorw("Unable to lock car for retiring",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return err
+	}
 
-	query := "SELECT id, created, modified, payment_processor_id, payment_processor, wallet_id, status, user_id FROM account WHERE id = ? AND active = true"
-	row := db.QueryRowContext(ctx, query, id)
+	if err = checkVersion(id, version, car.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	if row == nil {
-		slog.Errorw("Unable to fetch account with id "+id,
-			"query", query)
-		return nil, nil
+	query = "SELECT COUNT(*) FROM carBooking WHERE CarID = ? AND status IN ('pending','confirmed','in_progress') AND EndDateTime > ?"
+	var futureBookings int
+	err = tx.QueryRowContext(ctx, query, id, time.Now().UTC()).Scan(&futureBookings)
+	if err != nil {
+		slog.Errorw("Unable to count future bookings of car",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return err
+	}
+
+	if futureBookings > 0 {
+		tx.Rollback()
+		return ErrCarHasFutureBookings
+	}
+
+	query = "UPDATE Car SET retired = true, available = false, version = version + 1 WHERE id = ?"
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to retire car as the database query could not be executed")
+		tx.Rollback()
+		return err
+	}
+
+	car.Retired = true
+	car.Available = false
+	car.Version++
+
+	err = insertEvent(ctx, tx, newCarEvent(car))
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
 	if err != nil {
-		slog.Errorw("Unable to map data fetched from database "+os.Getenv("DB_NAME")+" for account with id "+id,
+		slog.Errorw("Unable to commit transaction to database",
 			"error", err)
-		return nil, err
 	}
 
-	return &account, nil
+	return err
 }
 
-// DeleteAccount account deletes account from database
-func DeleteAccount(id string) (int64, error) {
+// CreateBooking books a car for the given window after checking, under a lock
+// on the car, that no existing booking of the car overlaps it
+func (store *MySQLStore) CreateBooking(carbooking *CarBooking) error {
 	slog := logger.InitSugarLogger()
 	defer slog.Sync() // Flushes buffer, if any
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
-	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
-			"error", err)
-		return 0, err
-	}
+	carbooking.BookingId = uuid.New().String()
+	carbooking.Status = BookingPending
 
 	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelfunc()
 
-	query := "UPDATE account SET active = false WHERE id = '" + id + "'"
-	result, err := db.ExecContext(ctx, query)
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for creating new booking",
+			"error", err)
+		return err
+	}
 
+	// Lock the car row so that concurrent bookings of the same car are
+	// serialised, even when the car has no bookings yet, and cannot be
+	// retired or withdrawn while booked. The price snapshot must have been
+	// quoted at the version locked, so that it matches the car that is booked
+	query := "SELECT available, retired, version FROM Car WHERE id = ? FOR UPDATE"
+	var available, retired bool
+	var carVersion int
+	err = tx.QueryRowContext(ctx, query, carbooking.CarID).Scan(&available, &retired, &carVersion)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrCarNotFound
+	}
 	if err != nil {
-		slog.Errorw("Unable to delete account with id "+id,
+		slog.Errorw("Unable to lock car for booking",
+			"query", query,
 			"error", err)
-		return 0, err
+		tx.Rollback()
+		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if retired || !available {
+		tx.Rollback()
+		return ErrCarUnavailable
+	}
 
-	return rowsAffected, err
-}
+	if err = checkVersion(carbooking.CarID, carbooking.CarVersion, carVersion); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-// GetAccountList fetches list of accounts from database
-func GetAccountList(pageNumber int, pageSize int) (int, []User, error) {
-	slog := logger.InitSugarLogger()
-	var accounts []User
-	defer slog.Sync() // Flushes buffer, if any
+	// Check the user's driving licence allows the booking. The licence is
+	// read under a shared lock so that it cannot be reviewed or replaced
+	// until the booking is made
+	query = "SELECT " + licenceColumns + " FROM licence WHERE userId = ? LOCK IN SHARE MODE"
+	licence, err := scanLicence(tx.QueryRowContext(ctx, query, carbooking.UserID).Scan)
+	var held *Licence
+	if err == nil {
+		held = &licence
+	} else if err != sql.ErrNoRows {
+		slog.Errorw("Unable to fetch driving licence for booking",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return err
+	}
+	if err = checkLicence(carbooking.UserID, held, *carbooking.EndDateTime); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	db, err := createClient(os.Getenv("DB_NAME"))
-	defer db.Close()
+	// Check car availability by locking the car's bookings that overlap
+	// the requested window. Cancelled bookings have released their slot
+	query = "SELECT BookingId FROM carBooking WHERE CarID = ? AND status <> 'cancelled' AND StartDateTime < ? AND EndDateTime > ? LIMIT 1 FOR UPDATE"
+	var conflictingID string
+	err = tx.QueryRowContext(ctx, query, carbooking.CarID, carbooking.EndDateTime, carbooking.StartDateTime).Scan(&conflictingID)
+	if err == nil {
+		tx.Rollback()
+		return &BookingConflictError{CarID: carbooking.CarID, BookingID: conflictingID}
+	}
+	if err != sql.ErrNoRows {
+		slog.Errorw("Unable to check car availability",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return err
+	}
+
+	carbooking.Version = 1
+	query = "INSERT INTO carBooking (BookingId,CarID,UserID,status,StartDateTime,EndDateTime,basePrice,PPH,hourlyCharge,securitydeposit,discount,taxes,total) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	_, err = tx.ExecContext(ctx, query, carbooking.BookingId, carbooking.CarID, carbooking.UserID, carbooking.Status, carbooking.StartDateTime, carbooking.EndDateTime,
+		carbooking.BasePrice, carbooking.PPH, carbooking.HourlyCharge, carbooking.Securitydeposit, carbooking.Discount, carbooking.Taxes, carbooking.Total)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to create booking as the database query could not be executed")
+		tx.Rollback()
+		return err
+	}
+
+	err = insertEvent(ctx, tx, newBookingEvent(EventBookingCreated, *carbooking))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
 	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to commit transaction to database",
 			"error", err)
-		return 0, nil, err
 	}
+	return err
+}
+
+// GetAccount fetches account details from database
+func (store *MySQLStore) GetAccount(id string) (*User, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
 
 	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelfunc()
 
-	query := "SELECT id, created, modified, payment_processor_id, payment_processor, wallet_id, status, user_id FROM account WHERE active = true"
+	query := "SELECT " + userColumns + " FROM User WHERE id = ? AND active = true"
+	account, err := scanUser(store.db.QueryRowContext(ctx, query, id).Scan)
 
-	results, err := db.QueryContext(ctx, query)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 
 	if err != nil {
-		slog.Errorw("Unable to create client for database "+os.Getenv("DB_NAME"),
+		slog.Errorw("Unable to map data fetched from database "+store.dbName+" for account with id "+id,
+			"query", query,
 			"error", err)
-		return 0, nil, err
+		return nil, err
 	}
 
-	itemCount := 0
-	for results.Next() {
-		var account User
+	return &account, nil
+}
 
+// GetUserByUID fetches the active user signed in as uid
+func (store *MySQLStore) GetUserByUID(uid string) (*User, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + userColumns + " FROM User WHERE uid = ? AND active = true"
+	account, err := scanUser(store.db.QueryRowContext(ctx, query, uid).Scan)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		slog.Errorw("Unable to map data fetched from database "+store.dbName+" for account with uid "+uid,
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// DeleteAccount account deletes account from database
+func (store *MySQLStore) DeleteAccount(id string) (int64, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "UPDATE User SET active = false WHERE id = ? AND active = true"
+	result, err := store.db.ExecContext(ctx, query, id)
+
+	if err != nil {
+		slog.Errorw("Unable to delete account with id "+id,
+			"query", query,
+			"error", err)
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	return rowsAffected, err
+}
+
+// SearchAvailableCars fetches cars that are available and have no booking
+// overlapping the given window
+func (store *MySQLStore) SearchAvailableCars(from time.Time, to time.Time) ([]Car, error) {
+	slog := logger.InitSugarLogger()
+	var cars []Car
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + carColumns + " FROM Car c WHERE c.available = true AND NOT EXISTS (SELECT 1 FROM carBooking b WHERE b.CarID = c.id AND b.status <> 'cancelled' AND b.StartDateTime < ? AND b.EndDateTime > ?)"
+
+	results, err := store.db.QueryContext(ctx, query, to, from)
+	if err != nil {
+		slog.Errorw("Unable to search available cars",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		car, err := scanCar(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		cars = append(cars, car)
+	}
+
+	return cars, results.Err()
+}
+
+// ListCars fetches cars matching filter
+func (store *MySQLStore) ListCars(filter CarFilter) ([]Car, error) {
+	slog := logger.InitSugarLogger()
+	var cars []Car
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	if len(filter.Manufacturer) > 0 {
+		conditions = append(conditions, "c.manufacturer = ?")
+		args = append(args, filter.Manufacturer)
+	}
+	if len(filter.Model) > 0 {
+		conditions = append(conditions, "c.model = ?")
+		args = append(args, filter.Model)
+	}
+	if filter.MinPPH > 0 {
+		conditions = append(conditions, "c.PPH >= ?")
+		args = append(args, filter.MinPPH)
+	}
+	if filter.MaxPPH > 0 {
+		conditions = append(conditions, "c.PPH <= ?")
+		args = append(args, filter.MaxPPH)
+	}
+	if filter.Available != nil {
+		conditions = append(conditions, "c.available = ?")
+		args = append(args, *filter.Available)
+	}
+	if !filter.IncludeRetired {
+		conditions = append(conditions, "c.retired = false")
+	}
+	query := "SELECT " + carColumns + " FROM Car c WHERE " + strings.Join(conditions, " AND ") + " ORDER BY c.manufacturer, c.model, c.carLicenseNumber"
+
+	results, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Errorw("Unable to list cars",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		car, err := scanCar(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		cars = append(cars, car)
+	}
+
+	return cars, results.Err()
+}
+
+// GetCarsByLicense fetches cars having any of given licence numbers
+func (store *MySQLStore) GetCarsByLicense(numbers []string) ([]Car, error) {
+	slog := logger.InitSugarLogger()
+	var cars []Car
+	defer slog.Sync() // Flushes buffer, if any
+
+	if len(numbers) == 0 {
+		return cars, nil
+	}
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	args := make([]interface{}, len(numbers))
+	for i, number := range numbers {
+		args[i] = number
+	}
+	query := "SELECT " + carColumns + " FROM Car c WHERE c.carLicenseNumber IN (?" + strings.Repeat(",?", len(numbers)-1) + ")"
+
+	results, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Errorw("Unable to fetch cars by licence number",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		car, err := scanCar(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		cars = append(cars, car)
+	}
+
+	return cars, results.Err()
+}
+
+// isDuplicateKey reports whether err is MySQL rejecting a duplicate value of
+// a unique key
+func isDuplicateKey(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
+
+// userColumns lists User columns in the order scanned by scanUser
+const userColumns = "id, COALESCE(uid, ''), mobile, name, email, role, licenceStatus, active, created, modified, version"
+
+// scanUser maps a row selected with userColumns to a user
+func scanUser(scan func(dest ...interface{}) error) (User, error) {
+	var user User
+	err := scan(&user.ID, &user.UID, &user.Mobile, &user.Name, &user.Email, &user.Role, &user.LicenceStatus, &user.Active, &user.Created, &user.Modified, &user.Version)
+	return user, err
+}
+
+// carColumns lists columns of Car, aliased c, in the order scanned by scanCar
+const carColumns = "c.id, c.carLicenseNumber, c.manufacturer, c.model, c.basePrice, c.PPH, c.securitydeposit, c.available, c.retired, c.version"
+
+// scanCar maps a row selected with carColumns to a car
+func scanCar(scan func(dest ...interface{}) error) (Car, error) {
+	var car Car
+	err := scan(&car.ID, &car.CarLicenseNumber, &car.Manufacturer, &car.Model, &car.BasePrice, &car.PPH, &car.Securitydeposit, &car.Available, &car.Retired, &car.Version)
+	return car, err
+}
+
+// bookingColumns lists carBooking columns in the order scanned by scanBooking
+const bookingColumns = "BookingId, CarID, UserID, status, StartDateTime, EndDateTime, basePrice, PPH, hourlyCharge, securitydeposit, discount, taxes, total, refundAmount, cancelledAt, version"
+
+// scanBooking maps a row selected with bookingColumns to a booking
+func scanBooking(scan func(dest ...interface{}) error) (CarBooking, error) {
+	var booking CarBooking
+	err := scan(&booking.BookingId, &booking.CarID, &booking.UserID, &booking.Status, &booking.StartDateTime, &booking.EndDateTime,
+		&booking.BasePrice, &booking.PPH, &booking.HourlyCharge, &booking.Securitydeposit, &booking.Discount, &booking.Taxes, &booking.Total, &booking.RefundAmount, &booking.CancelledAt, &booking.Version)
+	return booking, err
+}
+
+// GetUserBookings fetches bookings made by a user
+func (store *MySQLStore) GetUserBookings(userID string) ([]CarBooking, error) {
+	return store.listBookings("UserID", userID)
+}
+
+// GetCarBookings fetches bookings of a car
+func (store *MySQLStore) GetCarBookings(carID string) ([]CarBooking, error) {
+	return store.listBookings("CarID", carID)
+}
+
+// listBookings fetches bookings whose column matches value, ordered by start
+func (store *MySQLStore) listBookings(column string, value string) ([]CarBooking, error) {
+	slog := logger.InitSugarLogger()
+	var bookings []CarBooking
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + bookingColumns + " FROM carBooking WHERE " + column + " = ? ORDER BY StartDateTime"
+
+	results, err := store.db.QueryContext(ctx, query, value)
+	if err != nil {
+		slog.Errorw("Unable to fetch bookings",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		booking, err := scanBooking(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+
+	return bookings, results.Err()
+}
+
+// GetBooking fetches booking details from database
+func (store *MySQLStore) GetBooking(id string) (*CarBooking, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + bookingColumns + " FROM carBooking WHERE BookingId = ?"
+	booking, err := scanBooking(store.db.QueryRowContext(ctx, query, id).Scan)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		slog.Errorw("Unable to map data fetched from database "+store.dbName+" for booking with id "+id,
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+
+	query = "SELECT id, BookingId, kind, previousEndDateTime, EndDateTime, amount, created FROM bookingAdjustment WHERE BookingId = ? ORDER BY created"
+	results, err := store.db.QueryContext(ctx, query, id)
+	if err != nil {
+		slog.Errorw("Unable to fetch adjustments of booking with id "+id,
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var adjustment BookingAdjustment
+		err = results.Scan(&adjustment.ID, &adjustment.BookingID, &adjustment.Kind, &adjustment.PreviousEndDateTime, &adjustment.EndDateTime, &adjustment.Amount, &adjustment.Created)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		booking.Adjustments = append(booking.Adjustments, adjustment)
+	}
+
+	return &booking, results.Err()
+}
+
+// UpdateBookingStatus moves a booking to given status, enforcing the booking
+// status transition table
+func (store *MySQLStore) UpdateBookingStatus(id string, version int, status BookingStatus) (*CarBooking, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for updating booking status",
+			"error", err)
+		return nil, err
+	}
+
+	booking, err := lockBooking(ctx, tx, id, version)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !booking.Status.CanTransitionTo(status) {
+		tx.Rollback()
+		return nil, &InvalidTransitionError{BookingID: id, From: booking.Status, To: status}
+	}
+
+	query := "UPDATE carBooking SET status = ?, version = version + 1 WHERE BookingId = ?"
+	_, err = tx.ExecContext(ctx, query, status, id)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to update booking status as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	booking.Status = status
+	booking.Version++
+
+	if status == BookingCompleted {
+		err = insertEvent(ctx, tx, newBookingEvent(EventBookingCompleted, *booking))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+
+	return booking, nil
+}
+
+// CancelBooking cancels a booking, releasing its slot, and records the refund
+// computed by refund from the locked booking
+func (store *MySQLStore) CancelBooking(id string, version int, refund func(booking CarBooking) int) (*CarBooking, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for cancelling booking",
+			"error", err)
+		return nil, err
+	}
+
+	booking, err := lockBooking(ctx, tx, id, version)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !booking.Status.CanTransitionTo(BookingCancelled) {
+		tx.Rollback()
+		return nil, &InvalidTransitionError{BookingID: id, From: booking.Status, To: BookingCancelled}
+	}
+
+	cancelledAt := time.Now().UTC()
+	refundAmount := refund(*booking)
+
+	query := "UPDATE carBooking SET status = ?, refundAmount = ?, cancelledAt = ?, version = version + 1 WHERE BookingId = ?"
+	_, err = tx.ExecContext(ctx, query, BookingCancelled, refundAmount, cancelledAt, id)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to cancel booking as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	booking.Status = BookingCancelled
+	booking.RefundAmount = refundAmount
+	booking.CancelledAt = &cancelledAt
+	booking.Version++
+
+	err = insertEvent(ctx, tx, newBookingEvent(EventBookingCancelled, *booking))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+
+	return booking, nil
+}
+
+// ChangeBookingEnd moves the end of a booking for an extension or early
+// return. An extension is checked, under a lock on the car, against other
+// bookings of the car and the user's driving licence. The booking is
+// re-priced by the amount reprice computes from the locked booking and car,
+// which is recorded as an adjustment line
+func (store *MySQLStore) ChangeBookingEnd(id string, version int, kind AdjustmentKind, end time.Time, reprice func(booking CarBooking, car Car) int) (*CarBooking, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for changing booking end",
+			"error", err)
+		return nil, err
+	}
+
+	// Lock the car before the booking, in the same order as CreateBooking
+	query := "SELECT " + carColumns + " FROM Car c JOIN carBooking b ON b.CarID = c.id WHERE b.BookingId = ? FOR UPDATE"
+	car, err := scanCar(tx.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, ErrBookingNotFound
+	}
+	if err != nil {
+		slog.Errorw("Unable to lock car of booking",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	booking, err := lockBooking(ctx, tx, id, version)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = checkAdjustment(*booking, kind, end)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	previousEnd := *booking.EndDateTime
+
+	if kind == AdjustmentExtension {
+		// The driving licence must allow the booking until its new end. It is
+		// read under a shared lock, as in CreateBooking
+		query = "SELECT " + licenceColumns + " FROM licence WHERE userId = ? LOCK IN SHARE MODE"
+		licence, err := scanLicence(tx.QueryRowContext(ctx, query, booking.UserID).Scan)
+		var held *Licence
+		if err == nil {
+			held = &licence
+		} else if err != sql.ErrNoRows {
+			slog.Errorw("Unable to fetch driving licence for booking extension",
+				"query", query,
+				"error", err)
+			tx.Rollback()
+			return nil, err
+		}
+		if err = checkLicence(booking.UserID, held, end); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		query = "SELECT BookingId FROM carBooking WHERE CarID = ? AND BookingId <> ? AND status <> 'cancelled' AND StartDateTime < ? AND EndDateTime > ? LIMIT 1 FOR UPDATE"
+		var conflictingID string
+		err = tx.QueryRowContext(ctx, query, car.ID, id, end, previousEnd).Scan(&conflictingID)
+		if err == nil {
+			tx.Rollback()
+			return nil, &BookingConflictError{CarID: car.ID, BookingID: conflictingID}
+		}
+		if err != sql.ErrNoRows {
+			slog.Errorw("Unable to check car availability",
+				"query", query,
+				"error", err)
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	created := time.Now().UTC()
+	adjustment := BookingAdjustment{
+		ID:                  uuid.New().String(),
+		BookingID:           id,
+		Kind:                kind,
+		PreviousEndDateTime: &previousEnd,
+		EndDateTime:         &end,
+		Amount:              reprice(*booking, car),
+		Created:             &created,
+	}
+
+	query = "UPDATE carBooking SET EndDateTime = ?, total = total + ?, version = version + 1 WHERE BookingId = ?"
+	_, err = tx.ExecContext(ctx, query, end, adjustment.Amount, id)
+	if err == nil {
+		query = "INSERT INTO bookingAdjustment (id,BookingId,kind,previousEndDateTime,EndDateTime,amount,created) VALUES (?,?,?,?,?,?,?)"
+		_, err = tx.ExecContext(ctx, query, adjustment.ID, adjustment.BookingID, adjustment.Kind, adjustment.PreviousEndDateTime, adjustment.EndDateTime, adjustment.Amount, adjustment.Created)
+	}
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to change booking end as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+
+	booking.EndDateTime = &end
+	booking.Total += adjustment.Amount
+	booking.Adjustments = append(booking.Adjustments, adjustment)
+	booking.Version++
+	return booking, nil
+}
+
+// lockBooking fetches a booking inside a transaction, locking its row until
+// the transaction ends, and checks it is at version unless that is 0
+func lockBooking(ctx context.Context, tx *sql.Tx, id string, version int) (*CarBooking, error) {
+	query := "SELECT " + bookingColumns + " FROM carBooking WHERE BookingId = ? FOR UPDATE"
+	booking, err := scanBooking(tx.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrBookingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = checkVersion(id, version, booking.Version); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// Utilisation reports, for every car not retired, the bookings that were
+// neither cancelled nor no-show and how long they overlap the window
+func (store *MySQLStore) Utilisation(from time.Time, to time.Time) ([]CarUtilisation, error) {
+	slog := logger.InitSugarLogger()
+	var utilisation []CarUtilisation
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + carColumns + ", COUNT(b.BookingId), COALESCE(SUM(TIMESTAMPDIFF(SECOND, GREATEST(b.StartDateTime, ?), LEAST(b.EndDateTime, ?))), 0) FROM Car c LEFT JOIN carBooking b ON b.CarID = c.id AND b.status NOT IN ('cancelled','no_show') AND b.StartDateTime < ? AND b.EndDateTime > ? WHERE c.retired = false GROUP BY c.id ORDER BY c.manufacturer, c.model, c.carLicenseNumber"
+
+	results, err := store.db.QueryContext(ctx, query, from, to, to, from)
+	if err != nil {
+		slog.Errorw("Unable to compute utilisation of cars",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var entry CarUtilisation
+		var seconds int64
+		entry.Car, err = scanCar(func(dest ...interface{}) error {
+			return results.Scan(append(dest, &entry.Bookings, &seconds)...)
+		})
 		if err != nil {
 			slog.Errorw("Unable to map fields to object",
 				"error", err)
-			return 0, nil, err
+			return nil, err
 		}
-		accounts = append(accounts, account)
-		itemCount++
+		entry.BookedDuration = time.Duration(seconds) * time.Second
+		utilisation = append(utilisation, entry)
 	}
 
-	return itemCount, accounts, nil
+	return utilisation, results.Err()
 }
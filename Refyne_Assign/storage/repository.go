@@ -0,0 +1,176 @@
+package storage
+
+import "time"
+
+// UserRepository persists users
+type UserRepository interface {
+	CreateUser(user *User) error
+	GetAccount(id string) (*User, error)
+	// GetUserByUID returns nil when no active user is signed in as uid
+	GetUserByUID(uid string) (*User, error)
+	// UpdateUser changes the mobile, name and email of user, recording each
+	// change in its history. It returns ErrUserNotFound when no active user
+	// with its id exists and a *VersionMismatchError when its version is set
+	// and not current
+	UpdateUser(user *User, changedBy string) error
+	// SetUserRole returns ErrUserNotFound when no active user with id exists
+	SetUserRole(id string, role Role, changedBy string) (*User, error)
+	// ListUserHistory returns the changes made to a user, oldest first
+	ListUserHistory(id string) ([]UserChange, error)
+	DeleteAccount(id string) (int64, error)
+}
+
+// LicenceRepository persists the driving licences of users and their review.
+// Submitting and reviewing a licence also changes the licence status of its
+// user, recorded in the user's history
+type LicenceRepository interface {
+	// SubmitLicence returns ErrUserNotFound when no active user with the
+	// licence's user id exists and ErrLicenceRegistered when another user
+	// submitted the same licence
+	SubmitLicence(licence *Licence, changedBy string) error
+	// GetLicence returns nil when the user has not submitted a licence
+	GetLicence(userID string) (*Licence, error)
+	// ReviewLicence returns ErrLicenceNotFound when the user has not
+	// submitted a licence
+	ReviewLicence(userID string, status LicenceStatus, reason string, reviewedBy string) (*Licence, error)
+}
+
+// CarRepository persists cars
+type CarRepository interface {
+	// CreateCar returns a *DuplicateLicenseError when the licence number of
+	// car is taken
+	CreateCar(car *Car) error
+	// CreateCars creates all cars or, on any error, none of them
+	CreateCars(cars []Car) error
+	// GetCar returns nil when no car with id exists
+	GetCar(id string) (*Car, error)
+	// GetCarsByLicense returns the cars having any of given licence numbers
+	GetCarsByLicense(numbers []string) ([]Car, error)
+	SearchAvailableCars(from time.Time, to time.Time) ([]Car, error)
+	// ListCars returns cars matching filter ordered by manufacturer, model
+	// and licence number
+	ListCars(filter CarFilter) ([]Car, error)
+	// UpdateCar returns ErrCarNotFound when no car with the id of car exists
+	// and a *VersionMismatchError when car.Version is set and not current
+	UpdateCar(car *Car) error
+	// RetireCar returns ErrCarHasFutureBookings when the car is still booked
+	RetireCar(id string, version int) error
+}
+
+// BookingRepository persists car bookings. Implementations reject bookings
+// overlapping a booking of the same car that is not cancelled with a
+// *BookingConflictError and enforce the booking status transition table.
+// Creating, cancelling and completing a booking writes the matching event to
+// the outbox with the change, as do changes to cars.
+//
+// Every change bumps the version of the changed car or booking. Methods
+// taking a version change the row only if it is at that version, returning a
+// *VersionMismatchError otherwise; version 0 changes it unconditionally
+type BookingRepository interface {
+	// CreateBooking returns ErrCarUnavailable when the car is retired or not
+	// available, a *LicenceError when the driving licence of the user is
+	// missing, not verified or expires before the booking ends, and a
+	// *VersionMismatchError when the car changed since the booking's price
+	// was quoted at its CarVersion
+	CreateBooking(booking *CarBooking) error
+	// GetBooking returns nil when no booking with id exists
+	GetBooking(id string) (*CarBooking, error)
+	GetUserBookings(userID string) ([]CarBooking, error)
+	GetCarBookings(carID string) ([]CarBooking, error)
+	UpdateBookingStatus(id string, version int, status BookingStatus) (*CarBooking, error)
+	CancelBooking(id string, version int, refund func(booking CarBooking) int) (*CarBooking, error)
+	ChangeBookingEnd(id string, version int, kind AdjustmentKind, end time.Time, reprice func(booking CarBooking, car Car) int) (*CarBooking, error)
+	// Utilisation reports, for every car not retired, the bookings that were
+	// neither cancelled nor no-show and how long they overlap the window
+	Utilisation(from time.Time, to time.Time) ([]CarUtilisation, error)
+}
+
+// IdempotencyRepository persists idempotency keys and the responses to the
+// requests made with them
+type IdempotencyRepository interface {
+	// ClaimIdempotencyKey saves record unless an unexpired record with its key
+	// exists, in which case that record is returned instead
+	ClaimIdempotencyKey(record *IdempotencyRecord) (*IdempotencyRecord, error)
+	// SaveIdempotentResponse stores the response to the request that claimed
+	// key, replayed until expiresAt
+	SaveIdempotentResponse(key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error
+	// ReleaseIdempotencyKey deletes key so that the request can be retried
+	ReleaseIdempotencyKey(key string) error
+}
+
+// OutboxRepository reads domain events written by the other repositories for
+// publishing. Events are published at least once
+type OutboxRepository interface {
+	// ClaimPendingEvents returns, oldest first, at most limit unpublished
+	// events due for an attempt at now, which are held from other relays
+	// until claimedUntil unless marked published or failed before
+	ClaimPendingEvents(now time.Time, limit int, claimedUntil time.Time) ([]OutboxEvent, error)
+	MarkEventPublished(id string, at time.Time) error
+	MarkEventFailed(id string, lastError string, nextAttemptAt time.Time) error
+}
+
+// OTPRepository persists one-time code challenges for signing in
+type OTPRepository interface {
+	// CreateOTPChallenge saves challenge unless limit challenges were created
+	// for its mobile number since given time, when it returns
+	// ErrOTPRateLimited
+	CreateOTPChallenge(challenge *OTPChallenge, since time.Time, limit int) error
+	// LatestOTPChallenge returns nil when no challenge exists for mobile
+	LatestOTPChallenge(mobile string) (*OTPChallenge, error)
+	// RecordOTPAttempt counts an attempt at an unverified challenge, returning
+	// false when it already had maxAttempts attempts or was verified
+	RecordOTPAttempt(id string, maxAttempts int) (bool, error)
+	// VerifyOTPChallenge marks the challenge verified at given time,
+	// returning false when it already was
+	VerifyOTPChallenge(id string, at time.Time) (bool, error)
+}
+
+// WebhookRepository persists partner webhook subscriptions and the deliveries
+// of events to them
+type WebhookRepository interface {
+	CreateSubscription(subscription *WebhookSubscription) error
+	// GetSubscription returns nil when no active subscription with id exists
+	GetSubscription(id string) (*WebhookSubscription, error)
+	// ListSubscriptions returns active subscriptions, oldest first
+	ListSubscriptions() ([]WebhookSubscription, error)
+	// DeleteSubscription returns ErrSubscriptionNotFound when no active
+	// subscription with id exists
+	DeleteSubscription(id string) error
+	// EnqueueDeliveries saves pending deliveries, skipping any of an event
+	// already enqueued for the subscription
+	EnqueueDeliveries(deliveries []WebhookDelivery) error
+	// ClaimPendingDeliveries returns, oldest first, at most limit pending
+	// deliveries due for an attempt at now, which are held from other
+	// deliverers until claimedUntil unless their attempt is recorded before
+	ClaimPendingDeliveries(now time.Time, limit int, claimedUntil time.Time) ([]WebhookDelivery, error)
+	// ListDeliveries returns deliveries to a subscription, newest first
+	ListDeliveries(subscriptionID string, limit int) ([]WebhookDelivery, error)
+	// RecordDeliveryAttempt saves the outcome of an attempt, with its status,
+	// attempts and next attempt, to the delivery
+	RecordDeliveryAttempt(delivery *WebhookDelivery) error
+	// ReplayDelivery makes a delivery to the subscription pending again, due
+	// now. It returns ErrDeliveryNotFound when there is no such delivery
+	ReplayDelivery(subscriptionID string, id string) (*WebhookDelivery, error)
+}
+
+// HealthChecker checks health of the backing storage
+type HealthChecker interface {
+	Health() error
+}
+
+// Store bundles the repositories of the application with a health check of
+// the backing storage
+type Store interface {
+	UserRepository
+	LicenceRepository
+	CarRepository
+	BookingRepository
+	IdempotencyRepository
+	OutboxRepository
+	WebhookRepository
+	OTPRepository
+	HealthChecker
+}
+
+var _ Store = (*MySQLStore)(nil)
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,29 @@
+package storage
+
+// Role represents what a user is permitted to do
+type Role string
+
+// User roles
+const (
+	// RoleCustomer books cars for themselves
+	RoleCustomer Role = "customer"
+	// RoleFleetManager manages cars and moves bookings through their lifecycle
+	RoleFleetManager Role = "fleet_manager"
+	// RoleSupport acts on the accounts and bookings of customers
+	RoleSupport Role = "support"
+	// RoleAdmin may do everything
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role
+var Roles = []Role{RoleCustomer, RoleFleetManager, RoleSupport, RoleAdmin}
+
+// Valid reports whether role is one of Roles
+func (role Role) Valid() bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package storage
+
+import "time"
+
+// BookingStatus represents the lifecycle state of a car booking
+type BookingStatus string
+
+// Booking statuses
+const (
+	BookingPending    BookingStatus = "pending"
+	BookingConfirmed  BookingStatus = "confirmed"
+	BookingInProgress BookingStatus = "in_progress"
+	BookingCompleted  BookingStatus = "completed"
+	BookingCancelled  BookingStatus = "cancelled"
+	BookingNoShow     BookingStatus = "no_show"
+)
+
+// LicenceStatus represents the review state of a user's driving licence
+type LicenceStatus string
+
+// Driving licence statuses
+const (
+	LicenceMissing  LicenceStatus = "missing"
+	LicencePending  LicenceStatus = "pending"
+	LicenceVerified LicenceStatus = "verified"
+	LicenceRejected LicenceStatus = "rejected"
+)
+
+// bookingTransitions lists the statuses a booking may move to from each
+// status. Completed, cancelled and no-show bookings are final
+var bookingTransitions = map[BookingStatus][]BookingStatus{
+	BookingPending:    {BookingConfirmed, BookingCancelled},
+	BookingConfirmed:  {BookingInProgress, BookingCancelled, BookingNoShow},
+	BookingInProgress: {BookingCompleted},
+}
+
+// CanTransitionTo reports whether a booking in status may move to status to
+func (status BookingStatus) CanTransitionTo(to BookingStatus) bool {
+	for _, allowed := range bookingTransitions[status] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAdjustment checks that the end of booking may be moved to end for an
+// adjustment of given kind
+func checkAdjustment(booking CarBooking, kind AdjustmentKind, end time.Time) error {
+	if booking.Status != BookingPending && booking.Status != BookingConfirmed && booking.Status != BookingInProgress {
+		return ErrBookingClosed
+	}
+
+	if !end.After(*booking.StartDateTime) ||
+		(kind == AdjustmentExtension && !end.After(*booking.EndDateTime)) ||
+		(kind == AdjustmentEarlyReturn && !end.Before(*booking.EndDateTime)) {
+		return ErrInvalidAdjustment
+	}
+	return nil
+}
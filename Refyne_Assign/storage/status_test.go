@@ -0,0 +1,20 @@
+package storage
+
+import "testing"
+
+func TestBookingStatusCanTransitionTo(t *testing.T) {
+	statuses := []BookingStatus{BookingPending, BookingConfirmed, BookingInProgress, BookingCompleted, BookingCancelled, BookingNoShow}
+	allowed := map[BookingStatus]map[BookingStatus]bool{
+		BookingPending:    {BookingConfirmed: true, BookingCancelled: true},
+		BookingConfirmed:  {BookingInProgress: true, BookingCancelled: true, BookingNoShow: true},
+		BookingInProgress: {BookingCompleted: true},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got, want := from.CanTransitionTo(to), allowed[from][to]; got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"../logger"
+	"github.com/google/uuid"
+)
+
+// userChanges lists the fields of user that differ in updated, by their name
+// in the user resource. Only the fields of the change are set
+func userChanges(user User, updated User) []UserChange {
+	var changes []UserChange
+	add := func(field string, from string, to string) {
+		if from != to {
+			changes = append(changes, UserChange{Field: field, OldValue: from, NewValue: to})
+		}
+	}
+	add("mobile", user.Mobile, updated.Mobile)
+	add("name", user.Name, updated.Name)
+	add("email", user.Email, updated.Email)
+	add("role", string(user.Role), string(updated.Role))
+	add("licenceStatus", string(user.LicenceStatus), string(updated.LicenceStatus))
+	return changes
+}
+
+// UpdateUser changes the mobile, name and email of the active user to those
+// of user, recording each field changed by changedBy in the user's history
+func (store *MySQLStore) UpdateUser(user *User, changedBy string) error {
+	updated, err := store.changeUser(user.ID, user.Version, changedBy, func(current *User) {
+		current.Mobile = user.Mobile
+		current.Name = user.Name
+		current.Email = user.Email
+	})
+	if err != nil {
+		return err
+	}
+	*user = *updated
+	return nil
+}
+
+// SetUserRole assigns role to the active user with given id, recording the
+// change by changedBy in the user's history
+func (store *MySQLStore) SetUserRole(id string, role Role, changedBy string) (*User, error) {
+	return store.changeUser(id, 0, changedBy, func(current *User) {
+		current.Role = role
+	})
+}
+
+// changeUser applies change to the active user with given id, on condition
+// it is at version expected when set
+func (store *MySQLStore) changeUser(id string, expected int, changedBy string, change func(user *User)) (*User, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for updating account",
+			"error", err)
+		return nil, err
+	}
+
+	user, err := updateUser(ctx, tx, id, expected, changedBy, change)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+	return user, nil
+}
+
+// updateUser applies change to the active user with given id inside tx,
+// recording each field changed by changedBy in the user's history. The
+// version is only moved on when a field is changed. The caller rolls back on
+// error
+func updateUser(ctx context.Context, tx *sql.Tx, id string, expected int, changedBy string, change func(user *User)) (*User, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	query := "SELECT " + userColumns + " FROM User WHERE id = ? AND active = true FOR UPDATE"
+	current, err := scanUser(tx.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		slog.Errorw("Unable to lock account for update",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+
+	if err = checkVersion(id, expected, current.Version); err != nil {
+		return nil, err
+	}
+
+	updated := current
+	change(&updated)
+	changes := userChanges(current, updated)
+	if len(changes) == 0 {
+		return &current, nil
+	}
+
+	modified := time.Now().UTC()
+	updated.Modified = &modified
+	updated.Version = current.Version + 1
+
+	query = "UPDATE User SET mobile = ?, name = ?, email = ?, role = ?, licenceStatus = ?, modified = ?, version = ? WHERE id = ?"
+	_, err = tx.ExecContext(ctx, query, updated.Mobile, updated.Name, updated.Email, updated.Role, updated.LicenceStatus, updated.Modified, updated.Version, id)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+
+	query = "INSERT INTO userHistory (id,userId,field,oldValue,newValue,changedBy,version,created) VALUES (?,?,?,?,?,?,?,?)"
+	for _, c := range changes {
+		_, err = tx.ExecContext(ctx, query, uuid.New().String(), id, c.Field, c.OldValue, c.NewValue, changedBy, updated.Version, modified)
+		if err != nil {
+			slog.Errorw("Unable to record change to account",
+				"query", query,
+				"error", err)
+			return nil, err
+		}
+	}
+	return &updated, nil
+}
+
+// ListUserHistory fetches the changes made to the user with given id, oldest
+// first
+func (store *MySQLStore) ListUserHistory(id string) ([]UserChange, error) {
+	slog := logger.InitSugarLogger()
+	var changes []UserChange
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT id, userId, field, oldValue, newValue, changedBy, version, created FROM userHistory WHERE userId = ? ORDER BY created, field"
+	results, err := store.db.QueryContext(ctx, query, id)
+	if err != nil {
+		slog.Errorw("Unable to fetch history of account with id "+id,
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var c UserChange
+		err = results.Scan(&c.ID, &c.UserID, &c.Field, &c.OldValue, &c.NewValue, &c.ChangedBy, &c.Version, &c.Created)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, results.Err()
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"../logger"
+)
+
+// subscriptionColumns lists webhookSubscription columns in the order scanned
+// by scanSubscription
+const subscriptionColumns = "id, url, eventTypes, carIds, secret, active, created"
+
+// scanSubscription maps a row selected with subscriptionColumns to a
+// subscription. Event types and car ids are stored comma separated
+func scanSubscription(scan func(dest ...interface{}) error) (WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	var eventTypes, carIDs string
+	err := scan(&subscription.ID, &subscription.URL, &eventTypes, &carIDs, &subscription.Secret, &subscription.Active, &subscription.Created)
+	for _, eventType := range splitList(eventTypes) {
+		subscription.EventTypes = append(subscription.EventTypes, EventType(eventType))
+	}
+	subscription.CarIDs = splitList(carIDs)
+	return subscription, err
+}
+
+// deliveryColumns lists webhookDelivery columns in the order scanned by
+// scanDelivery
+const deliveryColumns = "d.id, d.subscriptionId, d.eventId, d.eventType, d.payload, d.status, d.attempts, d.lastStatusCode, d.lastError, d.nextAttemptAt, d.lastAttemptAt, d.deliveredAt, d.created"
+
+// scanDelivery maps a row selected with deliveryColumns to a delivery
+func scanDelivery(scan func(dest ...interface{}) error) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Payload, &delivery.Status, &delivery.Attempts,
+		&delivery.LastStatusCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.DeliveredAt, &delivery.Created)
+	return delivery, err
+}
+
+func splitList(value string) []string {
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// CreateSubscription saves a new webhook subscription
+func (store *MySQLStore) CreateSubscription(subscription *WebhookSubscription) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	eventTypes := make([]string, len(subscription.EventTypes))
+	for i, eventType := range subscription.EventTypes {
+		eventTypes[i] = string(eventType)
+	}
+
+	query := "INSERT INTO webhookSubscription (id,url,eventTypes,carIds,secret,active,created) VALUES (?,?,?,?,?,?,?)"
+	_, err := store.db.ExecContext(ctx, query, subscription.ID, subscription.URL, strings.Join(eventTypes, ","), strings.Join(subscription.CarIDs, ","),
+		subscription.Secret, subscription.Active, subscription.Created)
+	if err != nil {
+		slog.Errorw("Unable to create webhook subscription",
+			"query", query,
+			"error", err)
+	}
+	return err
+}
+
+// GetSubscription fetches the active webhook subscription with given id
+func (store *MySQLStore) GetSubscription(id string) (*WebhookSubscription, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + subscriptionColumns + " FROM webhookSubscription WHERE id = ? AND active"
+	subscription, err := scanSubscription(store.db.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Errorw("Unable to fetch webhook subscription",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions fetches active webhook subscriptions, oldest first
+func (store *MySQLStore) ListSubscriptions() ([]WebhookSubscription, error) {
+	slog := logger.InitSugarLogger()
+	var subscriptions []WebhookSubscription
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "SELECT " + subscriptionColumns + " FROM webhookSubscription WHERE active ORDER BY created, id"
+	results, err := store.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Errorw("Unable to fetch webhook subscriptions",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		subscription, err := scanSubscription(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, results.Err()
+}
+
+// DeleteSubscription deactivates the webhook subscription with given id. Its
+// deliveries are kept for the record but no longer attempted
+func (store *MySQLStore) DeleteSubscription(id string) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "UPDATE webhookSubscription SET active = false WHERE id = ? AND active"
+	result, err := store.db.ExecContext(ctx, query, id)
+	if err != nil {
+		slog.Errorw("Unable to delete webhook subscription",
+			"query", query,
+			"error", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// EnqueueDeliveries saves pending deliveries in a single transaction. A
+// delivery of an event already enqueued for the subscription is skipped, so
+// that an event relayed more than once is delivered once
+func (store *MySQLStore) EnqueueDeliveries(deliveries []WebhookDelivery) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for enqueuing webhook deliveries",
+			"error", err)
+		return err
+	}
+
+	query := "INSERT INTO webhookDelivery (id,subscriptionId,eventId,eventType,payload,status,nextAttemptAt,created) VALUES (?,?,?,?,?,?,?,?)"
+	for _, delivery := range deliveries {
+		_, err = tx.ExecContext(ctx, query, delivery.ID, delivery.SubscriptionID, delivery.EventID, delivery.EventType, delivery.Payload,
+			DeliveryPending, delivery.NextAttemptAt, delivery.Created)
+		if isDuplicateKey(err) {
+			continue
+		}
+		if err != nil {
+			slog.Errorw("Unable to execute query in database transaction",
+				"query", query,
+				"error", err)
+			slog.Infow("Rolling back transaction to enqueue webhook deliveries as the database query could not be executed")
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+	}
+	return err
+}
+
+// ClaimPendingDeliveries fetches, oldest first, at most limit pending
+// deliveries to active subscriptions that are due for an attempt at given
+// time, and holds them from other deliverers until claimedUntil. Deliveries
+// locked by another deliverer claiming them are skipped. A delivery whose
+// attempt is not recorded by then is due again
+func (store *MySQLStore) ClaimPendingDeliveries(now time.Time, limit int, claimedUntil time.Time) ([]WebhookDelivery, error) {
+	slog := logger.InitSugarLogger()
+	var deliveries []WebhookDelivery
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	// Begin database transaction
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Errorw("Unable to begin database transaction for claiming webhook deliveries",
+			"error", err)
+		return nil, err
+	}
+
+	query := "SELECT " + deliveryColumns + " FROM webhookDelivery d JOIN webhookSubscription s ON s.id = d.subscriptionId" +
+		" WHERE s.active AND d.status = ? AND d.nextAttemptAt <= ? ORDER BY d.created, d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED"
+	results, err := tx.QueryContext(ctx, query, DeliveryPending, now, limit)
+	if err != nil {
+		slog.Errorw("Unable to fetch webhook deliveries",
+			"query", query,
+			"error", err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	for results.Next() {
+		delivery, err := scanDelivery(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			results.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	results.Close()
+	if err = results.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	args := []interface{}{claimedUntil}
+	for _, delivery := range deliveries {
+		args = append(args, delivery.ID)
+	}
+	query = "UPDATE webhookDelivery SET nextAttemptAt = ? WHERE id IN (?" + strings.Repeat(",?", len(deliveries)-1) + ")"
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Errorw("Unable to execute query in database transaction",
+			"query", query,
+			"error", err)
+		slog.Infow("Rolling back transaction to claim webhook deliveries as the database query could not be executed")
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the change if all queries ran successfully
+	err = tx.Commit()
+	if err != nil {
+		slog.Errorw("Unable to commit transaction to database",
+			"error", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ListDeliveries fetches at most limit deliveries to the subscription, newest
+// first
+func (store *MySQLStore) ListDeliveries(subscriptionID string, limit int) ([]WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhookDelivery d WHERE d.subscriptionId = ? ORDER BY d.created DESC, d.id DESC LIMIT ?"
+	return store.queryDeliveries(query, subscriptionID, limit)
+}
+
+func (store *MySQLStore) queryDeliveries(query string, args ...interface{}) ([]WebhookDelivery, error) {
+	slog := logger.InitSugarLogger()
+	var deliveries []WebhookDelivery
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	results, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.Errorw("Unable to fetch webhook deliveries",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	defer results.Close()
+
+	for results.Next() {
+		delivery, err := scanDelivery(results.Scan)
+		if err != nil {
+			slog.Errorw("Unable to map fields to object",
+				"error", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, results.Err()
+}
+
+// RecordDeliveryAttempt saves the outcome of the latest attempt to deliver
+func (store *MySQLStore) RecordDeliveryAttempt(delivery *WebhookDelivery) error {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	if len(delivery.LastError) > maxLastErrorLength {
+		delivery.LastError = delivery.LastError[:maxLastErrorLength]
+	}
+
+	query := "UPDATE webhookDelivery SET status = ?, attempts = ?, lastStatusCode = ?, lastError = ?, nextAttemptAt = ?, lastAttemptAt = ?, deliveredAt = ? WHERE id = ?"
+	_, err := store.db.ExecContext(ctx, query, delivery.Status, delivery.Attempts, delivery.LastStatusCode, delivery.LastError,
+		delivery.NextAttemptAt, delivery.LastAttemptAt, delivery.DeliveredAt, delivery.ID)
+	if err != nil {
+		slog.Errorw("Unable to record attempt to deliver webhook",
+			"query", query,
+			"error", err)
+	}
+	return err
+}
+
+// ReplayDelivery makes the delivery pending and due now, with its attempts
+// reset so that retries back off from the start
+func (store *MySQLStore) ReplayDelivery(subscriptionID string, id string) (*WebhookDelivery, error) {
+	slog := logger.InitSugarLogger()
+	defer slog.Sync() // Flushes buffer, if any
+
+	ctx, cancelfunc := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelfunc()
+
+	query := "UPDATE webhookDelivery SET status = ?, attempts = 0, lastError = '', nextAttemptAt = ? WHERE id = ? AND subscriptionId = ?"
+	result, err := store.db.ExecContext(ctx, query, DeliveryPending, time.Now().UTC(), id, subscriptionID)
+	if err != nil {
+		slog.Errorw("Unable to replay webhook delivery",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+
+	query = "SELECT " + deliveryColumns + " FROM webhookDelivery d WHERE d.id = ?"
+	delivery, err := scanDelivery(store.db.QueryRowContext(ctx, query, id).Scan)
+	if err != nil {
+		slog.Errorw("Unable to fetch webhook delivery",
+			"query", query,
+			"error", err)
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,311 @@
+// Package validation checks struct fields against rules declared in
+// `validate` struct tags, such as
+//
+//	Mobile       string `json:"mobile_no" validate:"required,e164"`
+//	FromDateTime int64  `json:"from_date_time" validate:"required,before=ToDateTime"`
+//
+// Rules are separated by commas and checked in order; a field fails on its
+// first broken rule. Fields are reported by their JSON name
+package validation
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError describes a field that broke a validation rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is returned when a struct breaks validation rules, with one entry
+// per invalid field in declaration order
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Field + " " + e.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// dateLayout is the layout of dates checked by the date, past and future rules
+const dateLayout = "2006-01-02"
+
+var (
+	e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// platePattern matches Indian registration numbers such as KA01AB1234,
+	// KA 01 AB 1234 and 22BH1234AA
+	platePattern = regexp.MustCompile(`^(?i)([A-Z]{2}[ -]?[0-9]{1,2}[ -]?[A-Z]{0,3}[ -]?[0-9]{1,4}|[0-9]{2}[ -]?BH[ -]?[0-9]{4}[ -]?[A-Z]{1,2})$`)
+	// nonPublicNetworks lists private, shared and reserved networks besides
+	// the loopback, link-local, multicast and unspecified addresses
+	nonPublicNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "198.18.0.0/15", "fc00::/7")
+)
+
+// rule checks value of a field of parent, given the rule parameter. It
+// returns a message when the field breaks the rule
+type rule func(value reflect.Value, parent reflect.Value, param string) string
+
+// rules lists rules by the name used in tags
+var rules = map[string]rule{
+	"required": func(value reflect.Value, _ reflect.Value, _ string) string {
+		switch {
+		case value.Kind() == reflect.String && len(strings.TrimSpace(value.String())) == 0,
+			value.Kind() == reflect.Slice && value.Len() == 0,
+			value.IsZero():
+			return "is required"
+		}
+		return ""
+	},
+	"e164":  stringRule(func(s string) bool { return e164Pattern.MatchString(s) }, "must be a mobile number in E.164 format, such as +919876543210"),
+	"plate": stringRule(func(s string) bool { return platePattern.MatchString(strings.TrimSpace(s)) }, "must be a vehicle registration number, such as KA01AB1234"),
+	"url": stringRule(func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0
+	}, "must be an absolute http or https URL"),
+	// publicurl checks a URL is https and does not name a loopback, private
+	// or link-local host, so that it cannot be used to reach internal
+	// services. Hosts named by DNS are checked when they are dialled
+	"publicurl": stringRule(func(s string) bool {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme != "https" || len(u.Hostname()) == 0 {
+			return false
+		}
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return false
+		}
+		ip := net.ParseIP(host)
+		return ip == nil || PublicIP(ip)
+	}, "must be an https URL of a public host"),
+	"email": stringRule(func(s string) bool {
+		address, err := mail.ParseAddress(s)
+		return err == nil && address.Address == s
+	}, "must be an email address, such as name@example.com"),
+	"minlen": func(value reflect.Value, _ reflect.Value, param string) string {
+		min, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("validation: minlen needs a number, got %q", param))
+		}
+		if value.Kind() == reflect.String && len(value.String()) > 0 && len(value.String()) < min {
+			return "must be at least " + param + " characters"
+		}
+		return ""
+	},
+	"date": stringRule(func(s string) bool {
+		_, err := time.Parse(dateLayout, s)
+		return err == nil
+	}, "must be a date such as 2030-12-31"),
+	"past":   dateRule(func(date time.Time, today time.Time) bool { return date.Before(today) }, "must be a date in the past"),
+	"future": dateRule(func(date time.Time, today time.Time) bool { return !date.Before(today) }, "must not be a date in the past"),
+	"maxlen": func(value reflect.Value, _ reflect.Value, param string) string {
+		max, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("validation: maxlen needs a number, got %q", param))
+		}
+		if value.Kind() == reflect.String && len(value.String()) > max {
+			return "must be at most " + param + " characters"
+		}
+		return ""
+	},
+	// oneof checks a string, or every string of a slice, is one of the space
+	// separated values of its parameter
+	"oneof": func(value reflect.Value, _ reflect.Value, param string) string {
+		values := strings.Fields(param)
+		allowed := func(s string) bool {
+			for _, v := range values {
+				if s == v {
+					return true
+				}
+			}
+			return false
+		}
+		message := "must be one of " + strings.Join(values, ", ")
+		switch value.Kind() {
+		case reflect.String:
+			if len(value.String()) > 0 && !allowed(value.String()) {
+				return message
+			}
+		case reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				if element := value.Index(i); element.Kind() == reflect.String && !allowed(element.String()) {
+					return "has " + strconv.Quote(element.String()) + ", each " + message
+				}
+			}
+		}
+		return ""
+	},
+	"positive": func(value reflect.Value, _ reflect.Value, _ string) string {
+		if n, ok := number(value); ok && n <= 0 {
+			return "must be positive"
+		}
+		return ""
+	},
+	"nonnegative": func(value reflect.Value, _ reflect.Value, _ string) string {
+		if n, ok := number(value); ok && n < 0 {
+			return "must not be negative"
+		}
+		return ""
+	},
+	"before": func(value reflect.Value, parent reflect.Value, param string) string {
+		other := parent.FieldByName(param)
+		if !other.IsValid() || value.IsZero() || other.IsZero() {
+			return ""
+		}
+		if !less(value, other) {
+			return "must be before " + jsonName(parent.Type(), param)
+		}
+		return ""
+	},
+}
+
+// Validate checks the fields of the struct, or pointer to struct, s against
+// their rules, returning Errors if any is broken. It panics on unknown rules
+func Validate(s interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(s))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || len(tag) == 0 {
+			continue
+		}
+
+		for _, spec := range strings.Split(tag, ",") {
+			name, param := spec, ""
+			if i := strings.Index(spec, "="); i >= 0 {
+				name, param = spec[:i], spec[i+1:]
+			}
+			check, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown rule %q on field %s", name, field.Name))
+			}
+			if message := check(value.Field(i), value, param); len(message) > 0 {
+				errs = append(errs, FieldError{Field: jsonName(value.Type(), field.Name), Rule: name, Message: message})
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validator validates request bodies for Echo's Context.Validate
+type Validator struct{}
+
+// Validate checks i against the rules in its struct tags
+func (Validator) Validate(i interface{}) error {
+	return Validate(i)
+}
+
+// ValidPlate reports whether s is a vehicle registration number
+func ValidPlate(s string) bool {
+	return platePattern.MatchString(strings.TrimSpace(s))
+}
+
+// stringRule returns a rule checking non-empty strings with valid
+func stringRule(valid func(s string) bool, message string) rule {
+	return func(value reflect.Value, _ reflect.Value, _ string) string {
+		if value.Kind() != reflect.String || len(value.String()) == 0 || valid(value.String()) {
+			return ""
+		}
+		return message
+	}
+}
+
+// dateRule returns a rule checking strings that are dates with valid, given
+// today's date in UTC. Strings that are not dates are left to the date rule
+func dateRule(valid func(date time.Time, today time.Time) bool, message string) rule {
+	return stringRule(func(s string) bool {
+		date, err := time.Parse(dateLayout, s)
+		if err != nil {
+			return true
+		}
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		return valid(date, today)
+	}, message)
+}
+
+// number returns value as a float when it is numeric
+func number(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// less reports whether a is before b, for numbers and times
+func less(a reflect.Value, b reflect.Value) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x < y
+	}
+	x, ok := reflect.Indirect(a).Interface().(time.Time)
+	if !ok {
+		return false
+	}
+	y, ok := reflect.Indirect(b).Interface().(time.Time)
+	return ok && x.Before(y)
+}
+
+// jsonName returns the name of a field of t in JSON
+func jsonName(t reflect.Type, name string) string {
+	field, ok := t.FieldByName(name)
+	if !ok {
+		return name
+	}
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if len(tag) == 0 || tag == "-" {
+		return name
+	}
+	return tag
+}
+
+// PublicIP reports whether ip is a public unicast address, rather than a
+// loopback, private, link-local, multicast or unspecified one
+func PublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNetworks parses networks given in CIDR notation
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,245 @@
+package validation
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	type window struct {
+		From int64 `json:"from_date_time" validate:"before=To"`
+		To   int64 `json:"to_date_time"`
+	}
+	type timeWindow struct {
+		From *time.Time `json:"from" validate:"before=To"`
+		To   *time.Time `json:"to"`
+	}
+	type required struct {
+		Name  string `json:"name" validate:"required"`
+		Count int    `json:"count" validate:"required"`
+	}
+	type mobile struct {
+		Mobile string `json:"mobile_no" validate:"e164"`
+	}
+	type plate struct {
+		Plate string `json:"plate" validate:"plate"`
+	}
+	type amounts struct {
+		Price   int     `json:"price" validate:"positive"`
+		Deposit float64 `json:"deposit" validate:"nonnegative"`
+	}
+	type profile struct {
+		Email string `json:"email" validate:"email"`
+		Name  string `json:"name" validate:"maxlen=5"`
+	}
+	type licence struct {
+		ExpiresOn   string `json:"expires_on" validate:"date,future"`
+		DateOfBirth string `json:"date_of_birth" validate:"date,past"`
+	}
+	type partner struct {
+		URL string `json:"url" validate:"publicurl"`
+	}
+	type subscription struct {
+		URL    string   `json:"url" validate:"url"`
+		Secret string   `json:"secret" validate:"minlen=16"`
+		Mode   string   `json:"mode" validate:"oneof=push pull"`
+		Events []string `json:"event_types" validate:"required,oneof=booking.created booking.cancelled"`
+	}
+	valid := subscription{URL: "https://partner.example.com/hooks", Secret: "0123456789abcdef", Mode: "push", Events: []string{"booking.created"}}
+	with := func(change func(s *subscription)) subscription {
+		changed := valid
+		change(&changed)
+		return changed
+	}
+	now := time.Now()
+	later := now.Add(time.Hour)
+	today := now.UTC().Format("2006-01-02")
+	yesterday := now.UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	tomorrow := now.UTC().AddDate(0, 0, 1).Format("2006-01-02")
+
+	tests := []struct {
+		name  string
+		value interface{}
+		// broken lists the fields and rules broken, in order
+		broken []string
+	}{
+		{"required set", required{Name: "Asha", Count: 1}, nil},
+		{"required missing", required{}, []string{"name required", "count required"}},
+		{"required blank", required{Name: "  ", Count: 1}, []string{"name required"}},
+		{"e164", mobile{"+919876543210"}, nil},
+		{"e164 empty is left to required", mobile{""}, nil},
+		{"e164 without plus", mobile{"919876543210"}, []string{"mobile_no e164"}},
+		{"e164 leading zero", mobile{"+0919876543210"}, []string{"mobile_no e164"}},
+		{"e164 too long", mobile{"+1234567890123456"}, []string{"mobile_no e164"}},
+		{"plate", plate{"KA01AB1234"}, nil},
+		{"plate spaced", plate{"KA 01 AB 1234"}, nil},
+		{"plate bharat series", plate{"22BH1234AA"}, nil},
+		{"plate lower case", plate{"ka01ab1234"}, nil},
+		{"plate malformed", plate{"K01AB1234"}, []string{"plate plate"}},
+		{"positive and nonnegative", amounts{Price: 1, Deposit: 0}, nil},
+		{"not positive", amounts{Price: 0, Deposit: 0}, []string{"price positive"}},
+		{"negative", amounts{Price: 1, Deposit: -0.5}, []string{"deposit nonnegative"}},
+		{"before", window{From: 1, To: 2}, nil},
+		{"equal is not before", window{From: 2, To: 2}, []string{"from_date_time before"}},
+		{"after", window{From: 3, To: 2}, []string{"from_date_time before"}},
+		{"before unset is left to required", window{From: 3}, nil},
+		{"before times", timeWindow{From: &now, To: &later}, nil},
+		{"after times", timeWindow{From: &later, To: &now}, []string{"from before"}},
+		{"pointer to struct", &window{From: 3, To: 2}, []string{"from_date_time before"}},
+		{"email", profile{Email: "asha@example.com"}, nil},
+		{"email empty is left to required", profile{}, nil},
+		{"email without domain", profile{Email: "asha@"}, []string{"email email"}},
+		{"email with display name", profile{Email: "Asha <asha@example.com>"}, []string{"email email"}},
+		{"maxlen exact", profile{Name: "Ashaa"}, nil},
+		{"maxlen long", profile{Name: "Ashaaa"}, []string{"name maxlen"}},
+		{"dates", licence{ExpiresOn: tomorrow, DateOfBirth: yesterday}, nil},
+		{"dates empty are left to required", licence{}, nil},
+		{"future today", licence{ExpiresOn: today, DateOfBirth: yesterday}, nil},
+		{"future in the past", licence{ExpiresOn: yesterday, DateOfBirth: yesterday}, []string{"expires_on future"}},
+		{"past today", licence{ExpiresOn: tomorrow, DateOfBirth: today}, []string{"date_of_birth past"}},
+		{"past in the future", licence{ExpiresOn: tomorrow, DateOfBirth: tomorrow}, []string{"date_of_birth past"}},
+		{"date malformed", licence{ExpiresOn: "31/12/2030", DateOfBirth: "1990-02-30"}, []string{"expires_on date", "date_of_birth date"}},
+		{"url https", valid, nil},
+		{"url http with port and path", with(func(s *subscription) { s.URL = "http://partner.example.com:8080/a/b?c=d" }), nil},
+		{"url empty is left to required", with(func(s *subscription) { s.URL = "" }), nil},
+		{"url relative", with(func(s *subscription) { s.URL = "/hooks" }), []string{"url url"}},
+		{"url other scheme", with(func(s *subscription) { s.URL = "ftp://partner.example.com/hooks" }), []string{"url url"}},
+		{"url without host", with(func(s *subscription) { s.URL = "https:///hooks" }), []string{"url url"}},
+		{"publicurl", partner{"https://partner.example.com/hooks"}, nil},
+		{"publicurl public address", partner{"https://203.0.113.7:8443/hooks"}, nil},
+		{"publicurl empty is left to required", partner{""}, nil},
+		{"publicurl http", partner{"http://partner.example.com/hooks"}, []string{"url publicurl"}},
+		{"publicurl localhost", partner{"https://localhost/hooks"}, []string{"url publicurl"}},
+		{"publicurl localhost subdomain", partner{"https://api.localhost./hooks"}, []string{"url publicurl"}},
+		{"publicurl loopback", partner{"https://127.0.0.1:8080/hooks"}, []string{"url publicurl"}},
+		{"publicurl private", partner{"https://192.168.1.10/hooks"}, []string{"url publicurl"}},
+		{"publicurl link-local", partner{"https://169.254.169.254/latest/meta-data"}, []string{"url publicurl"}},
+		{"publicurl ipv6 loopback", partner{"https://[::1]/hooks"}, []string{"url publicurl"}},
+		{"minlen exact", with(func(s *subscription) { s.Secret = "0123456789abcdef" }), nil},
+		{"minlen short", with(func(s *subscription) { s.Secret = "0123456789abcde" }), []string{"secret minlen"}},
+		{"minlen empty is left to required", with(func(s *subscription) { s.Secret = "" }), nil},
+		{"oneof string", with(func(s *subscription) { s.Mode = "pull" }), nil},
+		{"oneof string not allowed", with(func(s *subscription) { s.Mode = "poll" }), []string{"mode oneof"}},
+		{"oneof slice", with(func(s *subscription) { s.Events = []string{"booking.created", "booking.cancelled"} }), nil},
+		{"oneof slice element not allowed", with(func(s *subscription) { s.Events = []string{"booking.created", "car.updated"} }), []string{"event_types oneof"}},
+		{"required empty slice", with(func(s *subscription) { s.Events = []string{} }), []string{"event_types required"}},
+		{"not a struct", "value", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.value)
+			var broken []string
+			if err != nil {
+				errs, ok := err.(Errors)
+				if !ok {
+					t.Fatalf("got error %T, want Errors", err)
+				}
+				for _, e := range errs {
+					broken = append(broken, e.Field+" "+e.Rule)
+				}
+			}
+			if !reflect.DeepEqual(broken, test.broken) {
+				t.Errorf("got broken %v, want %v", broken, test.broken)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.7", true},
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.32.0.1", true},
+		{"192.168.0.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, test := range tests {
+		if got := PublicIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("PublicIP(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestValidateFirstBrokenRule(t *testing.T) {
+	value := struct {
+		Mobile string `json:"mobile_no" validate:"required,e164"`
+	}{}
+
+	errs, _ := Validate(value).(Errors)
+	if len(errs) != 1 || errs[0].Rule != "required" {
+		t.Fatalf("got %v, want only the required rule broken", errs)
+	}
+}
+
+func TestValidatePanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"unknown rule", struct {
+			Name string `validate:"nosuchrule"`
+		}{Name: "Asha"}, `unknown rule "nosuchrule" on field Name`},
+		{"minlen without a number", struct {
+			Name string `validate:"minlen=many"`
+		}{Name: "Asha"}, `minlen needs a number, got "many"`},
+		{"maxlen without a number", struct {
+			Name string `validate:"maxlen=few"`
+		}{Name: "Asha"}, `maxlen needs a number, got "few"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(r.(string), test.want) {
+					t.Errorf("got panic %v, want %s", r, test.want)
+				}
+			}()
+			Validate(test.value)
+		})
+	}
+}
+
+func TestErrorsFieldNames(t *testing.T) {
+	value := struct {
+		Tagged   string `json:"tagged_name,omitempty" validate:"required"`
+		Untagged string `validate:"required"`
+		Skipped  string `json:"-" validate:"required"`
+		From     int    `json:"from" validate:"before=Until"`
+		Until    int    `json:"until"`
+	}{From: 2, Until: 1}
+
+	errs, _ := Validate(value).(Errors)
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	if want := []string{"tagged_name", "Untagged", "Skipped", "from"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("got fields %v, want %v", fields, want)
+	}
+	if errs[3].Message != "must be before until" {
+		t.Errorf("got message %q, want it to name the other field by its JSON name", errs[3].Message)
+	}
+	if want := "validation failed: tagged_name is required; Untagged is required; Skipped is required; from must be before until"; errs.Error() != want {
+		t.Errorf("got %q, want %q", errs.Error(), want)
+	}
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"../config"
+	"../storage"
+	"../validation"
+	"go.uber.org/zap"
+)
+
+// Deliverer posts pending deliveries to their subscriptions. A delivery is
+// done when the subscriber responds 2xx; otherwise it is retried with
+// exponential backoff until it has been attempted MaxAttempts times, when it
+// is given up as failed. Failed deliveries can be replayed
+type Deliverer struct {
+	store  storage.WebhookRepository
+	client *http.Client
+	config config.Webhooks
+	log    *zap.SugaredLogger
+}
+
+// NewDeliverer returns a deliverer of deliveries in store as configured by
+// config
+func NewDeliverer(config config.Webhooks, store storage.WebhookRepository, log *zap.SugaredLogger) *Deliverer {
+	return &Deliverer{store: store, client: newPublicClient(config.Timeout), config: config, log: log}
+}
+
+// newPublicClient returns a client that connects only to public addresses,
+// whatever the hosts of subscriptions resolve to, so that subscriptions
+// cannot reach internal services. Redirects are not followed
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialPublic refuses connections to addresses that are not public
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !validation.PublicIP(ip) {
+		return fmt.Errorf("webhook: refusing to connect to %s, which is not a public address", host)
+	}
+	return nil
+}
+
+// Run attempts pending deliveries every poll interval until ctx is done
+func (deliverer *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(deliverer.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep delivering while full batches are pending, then wait. A batch
+		// with an attempt that could not be recorded also waits, rather than
+		// retrying at once against a store that is failing
+		for deliverer.DeliverOnce(ctx) == deliverer.config.BatchSize && ctx.Err() == nil {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverOnce claims a batch of pending deliveries and attempts them,
+// returning how many attempts were recorded. Claimed deliveries whose attempt
+// could not be recorded are attempted again once the claim times out
+func (deliverer *Deliverer) DeliverOnce(ctx context.Context) int {
+	now := time.Now().UTC()
+	pending, err := deliverer.store.ClaimPendingDeliveries(now, deliverer.config.BatchSize, now.Add(deliverer.config.ClaimTimeout))
+	if err != nil {
+		deliverer.log.Errorw("Unable to fetch pending webhook deliveries",
+			"error", err)
+		return 0
+	}
+
+	recorded := 0
+	subscriptions := map[string]*storage.WebhookSubscription{}
+	for i := range pending {
+		if ctx.Err() != nil {
+			return recorded
+		}
+
+		delivery := &pending[i]
+		subscription, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			subscription, err = deliverer.store.GetSubscription(delivery.SubscriptionID)
+			if err != nil {
+				deliverer.log.Errorw("Unable to fetch subscription of webhook delivery",
+					"id", delivery.ID,
+					"subscriptionId", delivery.SubscriptionID,
+					"error", err)
+				deliverer.postpone(delivery)
+				continue
+			}
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+		if subscription == nil {
+			// Deleted since the batch was fetched
+			continue
+		}
+		if deliverer.deliver(ctx, subscription, delivery) {
+			recorded++
+		}
+	}
+	return recorded
+}
+
+// postpone reschedules a delivery that could not be attempted to when it
+// would be retried after failing, without counting an attempt
+func (deliverer *Deliverer) postpone(delivery *storage.WebhookDelivery) {
+	next := time.Now().UTC().Add(deliverer.backoff(delivery.Attempts + 1))
+	delivery.NextAttemptAt = &next
+	if err := deliverer.store.RecordDeliveryAttempt(delivery); err != nil {
+		// The delivery is attempted again once the claim times out
+		deliverer.log.Errorw("Unable to postpone webhook delivery",
+			"id", delivery.ID,
+			"error", err)
+	}
+}
+
+// deliver posts delivery to the subscription and records the outcome,
+// returning whether it was recorded
+func (deliverer *Deliverer) deliver(ctx context.Context, subscription *storage.WebhookSubscription, delivery *storage.WebhookDelivery) bool {
+	now := time.Now().UTC()
+	statusCode, err := deliverer.post(ctx, subscription, delivery, now)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastAttemptAt = &now
+	switch {
+	case err == nil:
+		delivery.Status = storage.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= deliverer.config.MaxAttempts:
+		delivery.Status = storage.DeliveryFailed
+		delivery.LastError = err.Error()
+		deliverer.log.Warnw("Giving up webhook delivery",
+			"id", delivery.ID,
+			"subscriptionId", subscription.ID,
+			"attempts", delivery.Attempts,
+			"error", err)
+	default:
+		next := now.Add(deliverer.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = &next
+		deliverer.log.Warnw("Unable to deliver webhook, will retry",
+			"id", delivery.ID,
+			"subscriptionId", subscription.ID,
+			"attempts", delivery.Attempts,
+			"nextAttemptAt", next,
+			"error", err)
+	}
+
+	if err = deliverer.store.RecordDeliveryAttempt(delivery); err != nil {
+		// The delivery stays pending and is attempted again once the claim
+		// times out
+		deliverer.log.Errorw("Unable to record attempt to deliver webhook",
+			"id", delivery.ID,
+			"error", err)
+		return false
+	}
+	return true
+}
+
+// post sends the signed delivery, returning the response status code, if any
+func (deliverer *Deliverer) post(ctx context.Context, subscription *storage.WebhookSubscription, delivery *storage.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	if req.URL.Scheme != "https" {
+		return 0, fmt.Errorf("webhook %s is not an https URL", subscription.URL)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDeliveryID, delivery.ID)
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEventType, string(delivery.EventType))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, now, delivery.Payload))
+
+	resp, err := deliverer.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook %s responded %s", subscription.URL, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before retrying a delivery that failed attempts
+// times
+func (deliverer *Deliverer) backoff(attempts int) time.Duration {
+	delay := deliverer.config.RetryBackoff
+	for i := 1; i < attempts && delay < deliverer.config.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > deliverer.config.MaxRetryBackoff {
+		delay = deliverer.config.MaxRetryBackoff
+	}
+	return delay
+}
@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"../config"
+	"../storage"
+	"go.uber.org/zap"
+)
+
+// receiver is a partner's webhook endpoint responding with the status codes
+// queued, verifying the signature of every request it receives
+type receiver struct {
+	t         *testing.T
+	mu        sync.Mutex
+	responses []int
+	received  int
+}
+
+func (receiver *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := Verify("secret", r.Header.Get(HeaderSignature), body, time.Minute, time.Now()); err != nil {
+		receiver.t.Errorf("received delivery signed %q: %v", r.Header.Get(HeaderSignature), err)
+	}
+	if r.Header.Get(HeaderDeliveryID) != "delivery-1" || r.Header.Get(HeaderEventID) != "event-1" || r.Header.Get(HeaderEventType) != string(storage.EventBookingCreated) {
+		receiver.t.Errorf("received delivery with headers %v", r.Header)
+	}
+
+	status := http.StatusInternalServerError
+	if receiver.received < len(receiver.responses) {
+		status = receiver.responses[receiver.received]
+	}
+	receiver.received++
+	w.WriteHeader(status)
+}
+
+// newTestDeliverer returns a deliverer trusting the certificate of server and
+// connecting to it on the loopback address, which deliverers refuse otherwise
+func newTestDeliverer(cfg config.Webhooks, store storage.WebhookRepository, server *httptest.Server) *Deliverer {
+	deliverer := NewDeliverer(cfg, store, zap.NewNop().Sugar())
+	deliverer.client = server.Client()
+	deliverer.client.Timeout = cfg.Timeout
+	return deliverer
+}
+
+func TestDelivererDeliverOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []int
+		status    storage.DeliveryStatus
+		code      int
+	}{
+		{"accepted", []int{http.StatusOK}, storage.DeliveryDelivered, http.StatusOK},
+		{"retried on server error", []int{http.StatusServiceUnavailable, http.StatusNoContent}, storage.DeliveryDelivered, http.StatusNoContent},
+		{"given up after max attempts", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusInternalServerError}, storage.DeliveryFailed, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partner := &receiver{t: t, responses: test.responses}
+			server := httptest.NewTLSServer(partner)
+			defer server.Close()
+
+			store := storage.NewMemoryStore()
+			store.CreateSubscription(&storage.WebhookSubscription{ID: "subscription-1", URL: server.URL, Secret: "secret", Active: true})
+			now := time.Now().UTC()
+			store.EnqueueDeliveries([]storage.WebhookDelivery{{
+				ID: "delivery-1", SubscriptionID: "subscription-1", EventID: "event-1", EventType: storage.EventBookingCreated,
+				Payload: []byte(`{"id":"event-1"}`), NextAttemptAt: &now, Created: &now,
+			}})
+
+			// Retries are due as soon as they are scheduled
+			deliverer := newTestDeliverer(config.Webhooks{
+				Timeout: time.Second, BatchSize: 10, RetryBackoff: time.Nanosecond, MaxRetryBackoff: time.Nanosecond, MaxAttempts: 3,
+			}, store, server)
+
+			for attempt := 1; attempt <= len(test.responses); attempt++ {
+				if n := deliverer.DeliverOnce(context.Background()); n != 1 {
+					t.Fatalf("attempt %d: attempted %d deliveries, want 1", attempt, n)
+				}
+				deliveries, _ := store.ListDeliveries("subscription-1", 1)
+				delivery := deliveries[0]
+				if delivery.Attempts != attempt || delivery.LastStatusCode != test.responses[attempt-1] {
+					t.Fatalf("attempt %d: got %d attempts with status code %d", attempt, delivery.Attempts, delivery.LastStatusCode)
+				}
+				if attempt < len(test.responses) && (delivery.Status != storage.DeliveryPending || len(delivery.LastError) == 0) {
+					t.Fatalf("attempt %d: got delivery %s with error %q, want it pending retry", attempt, delivery.Status, delivery.LastError)
+				}
+			}
+
+			// Delivered and failed deliveries are not attempted again
+			if n := deliverer.DeliverOnce(context.Background()); n != 0 {
+				t.Errorf("attempted %d deliveries once done, want 0", n)
+			}
+			if partner.received != len(test.responses) {
+				t.Errorf("partner received %d requests, want %d", partner.received, len(test.responses))
+			}
+
+			deliveries, _ := store.ListDeliveries("subscription-1", 1)
+			delivery := deliveries[0]
+			if delivery.Status != test.status || delivery.LastStatusCode != test.code {
+				t.Errorf("got delivery %s with status code %d, want %s with %d", delivery.Status, delivery.LastStatusCode, test.status, test.code)
+			}
+			if (test.status == storage.DeliveryDelivered) != (delivery.DeliveredAt != nil) {
+				t.Errorf("got delivered at %v for delivery %s", delivery.DeliveredAt, delivery.Status)
+			}
+		})
+	}
+}
+
+// failingStore is a webhook store failing the operations given errors
+type failingStore struct {
+	storage.WebhookRepository
+	getErr    error
+	recordErr error
+}
+
+func (store *failingStore) GetSubscription(id string) (*storage.WebhookSubscription, error) {
+	if store.getErr != nil {
+		return nil, store.getErr
+	}
+	return store.WebhookRepository.GetSubscription(id)
+}
+
+func (store *failingStore) RecordDeliveryAttempt(delivery *storage.WebhookDelivery) error {
+	if store.recordErr != nil {
+		return store.recordErr
+	}
+	return store.WebhookRepository.RecordDeliveryAttempt(delivery)
+}
+
+func TestDelivererDeliverOnceFailingStore(t *testing.T) {
+	unavailable := errors.New("store unavailable")
+	cfg := config.Webhooks{Timeout: time.Second, BatchSize: 10, ClaimTimeout: time.Hour, RetryBackoff: time.Minute, MaxRetryBackoff: time.Hour, MaxAttempts: 3}
+
+	tests := []struct {
+		name  string
+		store failingStore
+		// received is how many requests the partner receives
+		received int
+		// postponed is whether the delivery is rescheduled by the backoff
+		// rather than held by the claim
+		postponed bool
+	}{
+		{"subscription lookup fails", failingStore{getErr: unavailable}, 0, true},
+		{"recording the attempt fails", failingStore{recordErr: unavailable}, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partner := &receiver{t: t, responses: []int{http.StatusOK}}
+			server := httptest.NewTLSServer(partner)
+			defer server.Close()
+
+			store := storage.NewMemoryStore()
+			store.CreateSubscription(&storage.WebhookSubscription{ID: "subscription-1", URL: server.URL, Secret: "secret", Active: true})
+			now := time.Now().UTC()
+			store.EnqueueDeliveries([]storage.WebhookDelivery{{
+				ID: "delivery-1", SubscriptionID: "subscription-1", EventID: "event-1", EventType: storage.EventBookingCreated,
+				Payload: []byte(`{"id":"event-1"}`), NextAttemptAt: &now, Created: &now,
+			}})
+			failing := test.store
+			failing.WebhookRepository = store
+
+			if n := newTestDeliverer(cfg, &failing, server).DeliverOnce(context.Background()); n != 0 {
+				t.Fatalf("recorded %d attempts, want 0", n)
+			}
+			if partner.received != test.received {
+				t.Errorf("partner received %d requests, want %d", partner.received, test.received)
+			}
+
+			// The delivery is not attempted again until it is due
+			if n := newTestDeliverer(cfg, store, server).DeliverOnce(context.Background()); n != 0 {
+				t.Errorf("attempted %d deliveries before due, want 0", n)
+			}
+			deliveries, _ := store.ListDeliveries("subscription-1", 1)
+			delivery := deliveries[0]
+			due := now.Add(cfg.ClaimTimeout)
+			if test.postponed {
+				due = now.Add(cfg.RetryBackoff)
+			}
+			if delivery.Attempts != 0 || delivery.Status != storage.DeliveryPending || delivery.NextAttemptAt.Before(due) || delivery.NextAttemptAt.After(due.Add(time.Minute)) {
+				t.Errorf("got delivery %s with %d attempts due at %v, want it pending due at %v", delivery.Status, delivery.Attempts, delivery.NextAttemptAt, due)
+			}
+		})
+	}
+}
+
+func TestDelivererRefusesInternalTargets(t *testing.T) {
+	partner := &receiver{t: t, responses: []int{http.StatusOK}}
+	server := httptest.NewTLSServer(partner)
+	defer server.Close()
+	plain := httptest.NewServer(partner)
+	defer plain.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		// client is the client of the server the deliverer is given, if not
+		// its own
+		client *http.Client
+		want   string
+	}{
+		{"loopback address", server.URL, nil, "not a public address"},
+		{"host resolving to loopback", strings.Replace(server.URL, "127.0.0.1", "localhost", 1), nil, "not a public address"},
+		{"private address", "https://10.0.0.1/hooks", nil, "not a public address"},
+		{"plain http", plain.URL, plain.Client(), "not an https URL"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := storage.NewMemoryStore()
+			store.CreateSubscription(&storage.WebhookSubscription{ID: "subscription-1", URL: test.url, Secret: "secret", Active: true})
+			now := time.Now().UTC()
+			store.EnqueueDeliveries([]storage.WebhookDelivery{{
+				ID: "delivery-1", SubscriptionID: "subscription-1", EventID: "event-1", EventType: storage.EventBookingCreated,
+				Payload: []byte(`{"id":"event-1"}`), NextAttemptAt: &now, Created: &now,
+			}})
+
+			deliverer := NewDeliverer(config.Webhooks{Timeout: time.Second, BatchSize: 10, RetryBackoff: time.Minute, MaxRetryBackoff: time.Hour, MaxAttempts: 3}, store, zap.NewNop().Sugar())
+			if test.client != nil {
+				deliverer.client = test.client
+			}
+			if n := deliverer.DeliverOnce(context.Background()); n != 1 {
+				t.Fatalf("attempted %d deliveries, want 1", n)
+			}
+
+			deliveries, _ := store.ListDeliveries("subscription-1", 1)
+			if !strings.Contains(deliveries[0].LastError, test.want) {
+				t.Errorf("got error %q, want it to contain %q", deliveries[0].LastError, test.want)
+			}
+			if partner.received != 0 {
+				t.Errorf("partner received %d requests, want none", partner.received)
+			}
+		})
+	}
+}
+
+func TestDelivererBackoff(t *testing.T) {
+	deliverer := NewDeliverer(config.Webhooks{RetryBackoff: 10 * time.Second, MaxRetryBackoff: time.Minute}, nil, zap.NewNop().Sugar())
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{5, time.Minute},
+		{64, time.Minute},
+	}
+
+	for _, test := range tests {
+		if got := deliverer.backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
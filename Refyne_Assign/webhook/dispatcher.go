@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"../events"
+	"../storage"
+	"github.com/google/uuid"
+)
+
+// Dispatcher is an events.Sink that fans an event out into a pending delivery
+// for every subscription wanting it. The relay retries the event if the
+// deliveries cannot be saved; an event already enqueued for a subscription is
+// not enqueued again
+type Dispatcher struct {
+	store storage.WebhookRepository
+}
+
+// NewDispatcher returns a dispatcher enqueuing deliveries to store
+func NewDispatcher(store storage.WebhookRepository) *Dispatcher {
+	return &Dispatcher{store: store}
+}
+
+// Publish enqueues a delivery of event to every subscription wanting it
+func (dispatcher *Dispatcher) Publish(ctx context.Context, event events.Event) error {
+	subscriptions, err := dispatcher.store.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	carID, err := carOf(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	var deliveries []storage.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !wants(subscription, storage.EventType(event.Type), carID) {
+			continue
+		}
+		deliveries = append(deliveries, storage.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      storage.EventType(event.Type),
+			Payload:        body,
+			Status:         storage.DeliveryPending,
+			NextAttemptAt:  &now,
+			Created:        &now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return dispatcher.store.EnqueueDeliveries(deliveries)
+}
+
+// wants reports whether subscription is for events of eventType about the car
+func wants(subscription storage.WebhookSubscription, eventType storage.EventType, carID string) bool {
+	typeMatches := false
+	for _, t := range subscription.EventTypes {
+		typeMatches = typeMatches || t == eventType
+	}
+	if !typeMatches || len(subscription.CarIDs) == 0 {
+		return typeMatches
+	}
+
+	for _, id := range subscription.CarIDs {
+		if id == carID {
+			return true
+		}
+	}
+	return false
+}
+
+// carOf returns the id of the car an event is about: the aggregate of car
+// events and the booked car of booking events
+func carOf(event events.Event) (string, error) {
+	if storage.EventType(event.Type) == storage.EventCarUpdated {
+		return event.AggregateID, nil
+	}
+
+	var data struct {
+		CarID string `json:"carId"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return "", fmt.Errorf("webhook: reading car of event %s: %w", event.ID, err)
+	}
+	return data.CarID, nil
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"../events"
+	"../storage"
+)
+
+func TestDispatcherPublish(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for _, subscription := range []storage.WebhookSubscription{
+		{ID: "all-bookings", EventTypes: []storage.EventType{storage.EventBookingCreated}, Active: true},
+		{ID: "car-1-bookings", EventTypes: []storage.EventType{storage.EventBookingCreated}, CarIDs: []string{"car-1"}, Active: true},
+		{ID: "car-2-bookings", EventTypes: []storage.EventType{storage.EventBookingCreated}, CarIDs: []string{"car-2"}, Active: true},
+		{ID: "car-updates", EventTypes: []storage.EventType{storage.EventCarUpdated}, Active: true},
+	} {
+		subscription := subscription
+		store.CreateSubscription(&subscription)
+	}
+
+	event := events.Event{ID: "event-1", Type: string(storage.EventBookingCreated), AggregateID: "booking-1", Data: json.RawMessage(`{"carId":"car-1"}`)}
+	if err := NewDispatcher(store).Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	for id, want := range map[string]int{"all-bookings": 1, "car-1-bookings": 1, "car-2-bookings": 0, "car-updates": 0} {
+		deliveries, _ := store.ListDeliveries(id, 10)
+		if len(deliveries) != want {
+			t.Errorf("subscription %s got %d deliveries, want %d", id, len(deliveries), want)
+		}
+	}
+}
+
+func TestDispatcherPublishMalformedEvent(t *testing.T) {
+	store := storage.NewMemoryStore()
+	store.CreateSubscription(&storage.WebhookSubscription{ID: "all-bookings", EventTypes: []storage.EventType{storage.EventBookingCreated}, Active: true})
+
+	// The car id is not a string, so the event cannot be matched to cars
+	event := events.Event{ID: "event-1", Type: string(storage.EventBookingCreated), AggregateID: "booking-1", Data: json.RawMessage(`{"carId":42}`)}
+	if err := NewDispatcher(store).Publish(context.Background(), event); err == nil {
+		t.Fatalf("got no error publishing a malformed event, want one for the relay to retry")
+	}
+
+	if deliveries, _ := store.ListDeliveries("all-bookings", 10); len(deliveries) != 0 {
+		t.Errorf("got %d deliveries of a malformed event, want none", len(deliveries))
+	}
+}
@@ -0,0 +1,68 @@
+// Package webhook delivers domain events to the webhooks partners subscribe
+// to. Events relayed from the outbox are fanned out into a delivery per
+// matching subscription, and deliveries are posted, signed with the secret of
+// the subscription, and retried with exponential backoff until accepted
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery
+const (
+	HeaderSignature  = "X-Webhook-Signature"
+	HeaderDeliveryID = "X-Webhook-Delivery"
+	HeaderEventID    = "X-Event-Id"
+	HeaderEventType  = "X-Event-Type"
+)
+
+// ErrInvalidSignature is returned by Verify when a signature does not match
+// the body, or is older than the tolerance
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header of body posted at timestamp, in the form
+// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>" keyed with
+// secret>. Signing the timestamp lets receivers reject replayed requests
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + mac(secret, t, body)
+}
+
+// Verify checks header is a signature of body with secret made within
+// tolerance of now. Partners receiving deliveries verify them the same way
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, signature string
+	for _, part := range strings.Split(header, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			t = part[2:]
+		case strings.HasPrefix(part, "v1="):
+			signature = part[3:]
+		}
+	}
+
+	seconds, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(mac(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret string, t string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t + "."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	signed := time.Unix(1615370400, 0)
+	body := []byte(`{"type":"booking.created"}`)
+	header := Sign("secret", signed, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		valid  bool
+	}{
+		{"round trip", "secret", header, body, signed, true},
+		{"within tolerance", "secret", header, body, signed.Add(5 * time.Minute), true},
+		{"clock behind within tolerance", "secret", header, body, signed.Add(-5 * time.Minute), true},
+		{"older than tolerance", "secret", header, body, signed.Add(5*time.Minute + time.Second), false},
+		{"ahead of tolerance", "secret", header, body, signed.Add(-5*time.Minute - time.Second), false},
+		{"other secret", "other", header, body, signed, false},
+		{"tampered body", "secret", header, []byte(`{"type":"booking.cancelled"}`), signed, false},
+		{"tampered timestamp", "secret", "t=1615370401" + header[len("t=1615370400"):], body, signed, false},
+		{"missing signature", "secret", "t=1615370400", body, signed, false},
+		{"malformed", "secret", "v1=abc", body, signed, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Verify(test.secret, test.header, test.body, 5*time.Minute, test.now)
+			if test.valid && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			if !test.valid && err != ErrInvalidSignature {
+				t.Errorf("got error %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}